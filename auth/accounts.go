@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"poa-manager/secrets"
+)
+
+const (
+	passwordIterations = 100000
+	passwordMinLength  = 8
+)
+
+var ErrInvalidPassword = errors.New("invalid name or password")
+
+type Account struct {
+	Name       string
+	Role       Role
+	Salt       []byte
+	Hash       []byte
+	Iterations int
+}
+
+type Accounts struct {
+	path     string
+	accounts map[string]*Account
+	mutex    *sync.Mutex
+}
+
+func hashPassword(password string) (salt []byte, hash []byte, err error) {
+	salt = make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return
+	}
+
+	hash = secrets.Pbkdf2([]byte(password), salt, passwordIterations, 32)
+	return
+}
+
+func (account *Account) verify(password string) bool {
+	if len(account.Hash) == 0 || account.Iterations <= 0 {
+		return false
+	}
+	hash := secrets.Pbkdf2([]byte(password), account.Salt, account.Iterations, len(account.Hash))
+	return subtle.ConstantTimeCompare(hash, account.Hash) == 1
+}
+
+func ValidatePassword(password string) error {
+	if len(password) < passwordMinLength {
+		return fmt.Errorf("password must be at least %d characters", passwordMinLength)
+	}
+
+	return nil
+}
+
+// LoadAccounts reads the account file. A missing file means no accounts yet.
+func LoadAccounts(path string) (*Accounts, error) {
+	accounts := &Accounts{path: path, accounts: map[string]*Account{}, mutex: &sync.Mutex{}}
+
+	doc, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return accounts, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	list := []*Account{}
+	if err := json.Unmarshal(doc, &list); err != nil {
+		return nil, err
+	}
+	for _, account := range list {
+		// an account without a hash would accept any password
+		if account.Name == "" || len(account.Hash) == 0 || account.Iterations <= 0 {
+			return nil, fmt.Errorf("invalid account in %s: %q", path, account.Name)
+		}
+		accounts.accounts[account.Name] = account
+	}
+
+	return accounts, nil
+}
+
+func (accounts *Accounts) save() error {
+	list := []*Account{}
+	for _, account := range accounts.accounts {
+		list = append(list, account)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	doc, err := json.MarshalIndent(list, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(accounts.path, doc, 0600)
+}
+
+func (accounts *Accounts) Empty() bool {
+	accounts.mutex.Lock()
+	defer accounts.mutex.Unlock()
+
+	return len(accounts.accounts) == 0
+}
+
+// List returns the account names and roles, without the password hashes.
+func (accounts *Accounts) List() []Account {
+	accounts.mutex.Lock()
+	defer accounts.mutex.Unlock()
+
+	list := []Account{}
+	for _, account := range accounts.accounts {
+		list = append(list, Account{Name: account.Name, Role: account.Role})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+func (accounts *Accounts) adminCount() int {
+	count := 0
+	for _, account := range accounts.accounts {
+		if account.Role == RoleAdmin {
+			count++
+		}
+	}
+
+	return count
+}
+
+// CreateFirstAdmin creates the admin account when there is no account yet,
+// and logs in with it.
+func (accounts *Accounts) CreateFirstAdmin(name, password string) error {
+	accounts.mutex.Lock()
+	if len(accounts.accounts) > 0 {
+		accounts.mutex.Unlock()
+		return errors.New("accounts already exist")
+	}
+	accounts.mutex.Unlock()
+
+	if err := accounts.put(name, password, RoleAdmin, false); err != nil {
+		return err
+	}
+
+	return accounts.Login(name, password)
+}
+
+// Add creates an account, the logged in operator needs the accounts permission.
+func (accounts *Accounts) Add(name, password string, role Role) error {
+	if err := Check(PermissionAccounts); err != nil {
+		return err
+	}
+
+	return accounts.put(name, password, role, false)
+}
+
+func (accounts *Accounts) put(name, password string, role Role, replace bool) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name is empty")
+	}
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+
+	salt, hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	accounts.mutex.Lock()
+	defer accounts.mutex.Unlock()
+
+	if _, ok := accounts.accounts[name]; ok && !replace {
+		return fmt.Errorf("account already exists: %s", name)
+	}
+	accounts.accounts[name] = &Account{Name: name, Role: role, Salt: salt, Hash: hash, Iterations: passwordIterations}
+
+	return accounts.save()
+}
+
+func (accounts *Accounts) Remove(name string) error {
+	if err := Check(PermissionAccounts); err != nil {
+		return err
+	}
+
+	accounts.mutex.Lock()
+	defer accounts.mutex.Unlock()
+
+	account, ok := accounts.accounts[name]
+	if !ok {
+		return fmt.Errorf("unknown account: %s", name)
+	}
+	if account.Role == RoleAdmin && accounts.adminCount() == 1 {
+		return errors.New("the last admin account can not be removed")
+	}
+
+	delete(accounts.accounts, name)
+	endSession(name)
+	return accounts.save()
+}
+
+func (accounts *Accounts) SetRole(name string, role Role) error {
+	if err := Check(PermissionAccounts); err != nil {
+		return err
+	}
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+
+	accounts.mutex.Lock()
+	defer accounts.mutex.Unlock()
+
+	account, ok := accounts.accounts[name]
+	if !ok {
+		return fmt.Errorf("unknown account: %s", name)
+	}
+	if account.Role == RoleAdmin && role != RoleAdmin && accounts.adminCount() == 1 {
+		return errors.New("the last admin account can not be changed")
+	}
+
+	account.Role = role
+	updateSessionRole(name, role)
+	return accounts.save()
+}
+
+// ChangePassword changes the password of the logged in operator.
+func (accounts *Accounts) ChangePassword(oldPassword, newPassword string) error {
+	current := CurrentSession()
+	if current == nil {
+		return ErrNotLoggedIn
+	}
+
+	accounts.mutex.Lock()
+	account, ok := accounts.accounts[current.Name]
+	accounts.mutex.Unlock()
+	if !ok || !account.verify(oldPassword) {
+		return ErrInvalidPassword
+	}
+
+	return accounts.put(account.Name, newPassword, account.Role, true)
+}
+
+func (accounts *Accounts) Login(name, password string) error {
+	accounts.mutex.Lock()
+	account, ok := accounts.accounts[strings.TrimSpace(name)]
+	accounts.mutex.Unlock()
+
+	if !ok || !account.verify(password) {
+		logger.LogfW("login failed: %s", name)
+		return ErrInvalidPassword
+	}
+
+	mutexSession.Lock()
+	session = &Session{Name: account.Name, Role: account.Role, LoginTime: time.Now().Unix()}
+	mutexSession.Unlock()
+
+	logger.LogfI("login: %s (%s)", account.Name, account.Role)
+
+	return nil
+}
+
+// Reauthenticate checks the password of the logged in operator again
+// before a fleet wide action.
+func (accounts *Accounts) Reauthenticate(password string) error {
+	current := CurrentSession()
+	if current == nil {
+		return ErrNotLoggedIn
+	}
+
+	accounts.mutex.Lock()
+	account, ok := accounts.accounts[current.Name]
+	accounts.mutex.Unlock()
+	if !ok || !account.verify(password) {
+		logger.LogfW("reauthentication failed: %s", current.Name)
+		return ErrInvalidPassword
+	}
+
+	return nil
+}
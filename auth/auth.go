@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"poa-manager/log"
+)
+
+var logger log.Logger = log.NewLogger("auth")
+
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+var Roles = []Role{RoleViewer, RoleOperator, RoleAdmin}
+
+type Permission int
+
+const (
+	// send commands to devices
+	PermissionCommand Permission = iota
+	// remove devices from the server
+	PermissionRemove
+	// save the manager configs
+	PermissionConfig
+	// manage the signing and payload keys
+	PermissionKeys
+	// manage the operator accounts
+	PermissionAccounts
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:   {},
+	RoleOperator: {PermissionCommand, PermissionRemove},
+	RoleAdmin:    {PermissionCommand, PermissionRemove, PermissionConfig, PermissionKeys, PermissionAccounts},
+}
+
+var (
+	ErrNotLoggedIn      = errors.New("not logged in")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+type Session struct {
+	Name      string
+	Role      Role
+	LoginTime int64
+}
+
+var (
+	session      *Session
+	mutexSession = &sync.Mutex{}
+)
+
+func (role Role) Text() string {
+	switch role {
+	case RoleViewer:
+		return "조회"
+	case RoleOperator:
+		return "운영"
+	case RoleAdmin:
+		return "관리자"
+	}
+
+	return string(role)
+}
+
+func (role Role) Has(permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (permission Permission) String() string {
+	switch permission {
+	case PermissionCommand:
+		return "command"
+	case PermissionRemove:
+		return "remove"
+	case PermissionConfig:
+		return "config"
+	case PermissionKeys:
+		return "keys"
+	case PermissionAccounts:
+		return "accounts"
+	}
+
+	return fmt.Sprintf("permission(%d)", int(permission))
+}
+
+// CurrentSession returns a copy of the logged in session, nil if nobody is logged in.
+func CurrentSession() *Session {
+	mutexSession.Lock()
+	defer mutexSession.Unlock()
+
+	if session == nil {
+		return nil
+	}
+	s := *session
+	return &s
+}
+
+// Check returns an error if the logged in operator does not have the permission.
+func Check(permission Permission) error {
+	mutexSession.Lock()
+	defer mutexSession.Unlock()
+
+	if session == nil {
+		return ErrNotLoggedIn
+	}
+	if !session.Role.Has(permission) {
+		logger.LogfW("%s (%s): %s %s", session.Name, session.Role, ErrPermissionDenied, permission)
+		return fmt.Errorf("%w: %s", ErrPermissionDenied, permission)
+	}
+
+	return nil
+}
+
+// SetSystemSession logs in without an account, for non interactive runs
+// such as the integration checks.
+func SetSystemSession(name string) {
+	mutexSession.Lock()
+	defer mutexSession.Unlock()
+
+	session = &Session{Name: name, Role: RoleAdmin, LoginTime: time.Now().Unix()}
+}
+
+// endSession logs out the account if it is logged in.
+func endSession(name string) {
+	mutexSession.Lock()
+	defer mutexSession.Unlock()
+
+	if session != nil && session.Name == name {
+		logger.LogfI("logout: %s (account removed)", name)
+		session = nil
+	}
+}
+
+// updateSessionRole applies the changed role to the logged in account.
+func updateSessionRole(name string, role Role) {
+	mutexSession.Lock()
+	defer mutexSession.Unlock()
+
+	if session != nil && session.Name == name {
+		session.Role = role
+	}
+}
+
+func Logout() {
+	mutexSession.Lock()
+	defer mutexSession.Unlock()
+
+	if session != nil {
+		logger.LogfI("logout: %s", session.Name)
+	}
+	session = nil
+}
@@ -0,0 +1,111 @@
+package context
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// CurrentConfigVersion is the ConfigVersion written to config.json.
+// Add a migration below when the layout of Configs changes.
+const CurrentConfigVersion = 1
+
+type configMigration struct {
+	version     int
+	description string
+	migrate     func(values map[string]interface{}) error
+}
+
+// configMigrations upgrades the config document one version at a time.
+var configMigrations = []configMigration{
+	{1, "versioned config, values converted to the field types", migrateToVersion1},
+}
+
+// migrateToVersion1 converts the values edited by hand with a wrong json type,
+// e.g. "MqttPort": "1883", which were silently ignored by older versions.
+func migrateToVersion1(values map[string]interface{}) error {
+	for _, field := range configFields() {
+		value, ok := values[field.Name]
+		if !ok {
+			continue
+		}
+
+		switch field.Type.Kind() {
+		case reflect.Int:
+			if text, ok := value.(string); ok {
+				number, err := strconv.Atoi(text)
+				if err != nil {
+					return fmt.Errorf("%s: %q is not an integer", field.Name, text)
+				}
+				values[field.Name] = number
+			}
+		case reflect.Bool:
+			if text, ok := value.(string); ok {
+				enabled, err := strconv.ParseBool(text)
+				if err != nil {
+					return fmt.Errorf("%s: %q is not true or false", field.Name, text)
+				}
+				values[field.Name] = enabled
+			}
+		case reflect.String:
+			switch value.(type) {
+			case float64, bool:
+				values[field.Name] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	return nil
+}
+
+func configVersion(values map[string]interface{}) int {
+	if version, ok := values["ConfigVersion"].(float64); ok {
+		return int(version)
+	}
+	return 0
+}
+
+// migrateConfig upgrades the config document to CurrentConfigVersion
+// and returns the version it was written with.
+func migrateConfig(values map[string]interface{}) (version int, migrated bool, err error) {
+	version = configVersion(values)
+	if version > CurrentConfigVersion {
+		logger.LogfW("config version %d is newer than %d of this manager, unknown settings are ignored", version, CurrentConfigVersion)
+		return version, false, nil
+	}
+
+	for _, migration := range configMigrations {
+		if migration.version <= version {
+			continue
+		}
+
+		if err = migration.migrate(values); err != nil {
+			return version, false, fmt.Errorf("config migration to version %d: %v", migration.version, err)
+		}
+		logger.LogfI("config migrated to version %d: %s", migration.version, migration.description)
+
+		values["ConfigVersion"] = migration.version
+		migrated = true
+	}
+
+	return version, migrated, nil
+}
+
+// unknownConfigKeys returns the keys of the config document which are not settings of this version.
+func unknownConfigKeys(values map[string]interface{}) []string {
+	known := map[string]bool{"ConfigVersion": true, "Secrets": true}
+	for _, field := range configFields() {
+		known[field.Name] = true
+	}
+
+	unknown := []string{}
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+
+	return unknown
+}
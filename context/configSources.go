@@ -0,0 +1,381 @@
+package context
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"poa-manager/log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+type ConfigSource string
+
+const (
+	SourceDefault ConfigSource = "default"
+	SourceFile    ConfigSource = "file"
+	SourceEnv     ConfigSource = "env"
+	SourceFlag    ConfigSource = "flag"
+)
+
+const (
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file"
+	LogOutputSyslog = "syslog"
+)
+
+const (
+	configFileName = "config.json"
+	configDirName  = "poa-manager"
+	envPrefix      = "POA_"
+	ConfigPathEnv  = envPrefix + "CONFIG"
+)
+
+var versionRegexp = regexp.MustCompile(`^v?\d+(\.\d+){0,2}$`)
+
+// DefaultConfigPath returns POA_CONFIG, config.json of the working directory
+// for the installs of older versions, or config.json in the user config directory.
+func DefaultConfigPath() string {
+	if path := os.Getenv(ConfigPathEnv); path != "" {
+		return path
+	}
+
+	if _, err := os.Stat(configFileName); err == nil {
+		return configFileName
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return configFileName
+	}
+	return filepath.Join(dir, configDirName, configFileName)
+}
+
+// words splits a field name: MqttBrokerAddress -> mqtt, broker, address
+// and LogFileMaxSizeMB -> log, file, max, size, mb
+func words(name string) []string {
+	words := []string{}
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		if !unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && !unicode.IsUpper(runes[i+1])) {
+			words = append(words, strings.ToLower(string(runes[start:i])))
+			start = i
+		}
+	}
+	return append(words, strings.ToLower(string(runes[start:])))
+}
+
+// EnvName returns the environment variable of the field: MqttPort -> POA_MQTT_PORT
+func EnvName(field string) string {
+	return envPrefix + strings.ToUpper(strings.Join(words(field), "_"))
+}
+
+// FlagName returns the command line flag of the field: MqttPort -> mqtt-port
+func FlagName(field string) string {
+	return strings.Join(words(field), "-")
+}
+
+func configFields() []reflect.StructField {
+	fields := []reflect.StructField{}
+	configsType := reflect.TypeOf(Configs{})
+	for i := 0; i < configsType.NumField(); i++ {
+		// the version is not a setting
+		if configsType.Field(i).IsExported() && configsType.Field(i).Name != "ConfigVersion" {
+			fields = append(fields, configsType.Field(i))
+		}
+	}
+	return fields
+}
+
+// setField parses the text into the field of the configs.
+func (configs *Configs) setField(field reflect.StructField, text string) error {
+	value := reflect.ValueOf(configs).Elem().FieldByIndex(field.Index)
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Int:
+		number, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		if number < 0 {
+			return errors.New("must not be negative")
+		}
+		value.SetInt(int64(number))
+	case reflect.Bool:
+		enabled, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		value.SetBool(enabled)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Kind())
+	}
+
+	return nil
+}
+
+// fileFields returns the fields present in the config file.
+func fileFields(path string) map[string]bool {
+	present := map[string]bool{}
+
+	doc, err := os.ReadFile(path)
+	if err != nil {
+		return present
+	}
+
+	values := map[string]json.RawMessage{}
+	if json.Unmarshal(doc, &values) != nil {
+		return present
+	}
+
+	for name := range values {
+		present[name] = true
+	}
+	if secrets, ok := values["Secrets"]; ok {
+		section := secretSection{}
+		if json.Unmarshal(secrets, &section) == nil {
+			for name := range section.Values {
+				present[name] = true
+			}
+		}
+	}
+
+	return present
+}
+
+// ApplyEnv overrides the configs by the POA_* environment variables.
+func (context *Context) ApplyEnv() error {
+	errs := []string{}
+	for _, field := range configFields() {
+		text, ok := os.LookupEnv(EnvName(field.Name))
+		if !ok {
+			continue
+		}
+
+		if err := context.Configs.setField(field, text); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid value %q for %s: %v", text, EnvName(field.Name), err))
+			continue
+		}
+		context.Sources[field.Name] = SourceEnv
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// ConfigFlags keeps the values of the command line flags of every Configs field.
+type ConfigFlags struct {
+	values map[string]*configFlag
+}
+
+type configFlag struct {
+	text string
+	set  bool
+}
+
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.text
+}
+
+func (f *configFlag) Set(text string) error {
+	f.text = text
+	f.set = true
+	return nil
+}
+
+// IsBoolFlag lets the bool fields be given as -retention-enabled
+type boolConfigFlag struct {
+	configFlag
+}
+
+func (f *boolConfigFlag) IsBoolFlag() bool {
+	return true
+}
+
+// RegisterConfigFlags adds a flag for every Configs field to the flag set.
+func RegisterConfigFlags(flagSet *flag.FlagSet) *ConfigFlags {
+	configFlags := &ConfigFlags{values: map[string]*configFlag{}}
+
+	for _, field := range configFields() {
+		usage := fmt.Sprintf("overrides %s of the config file (env %s)", field.Name, EnvName(field.Name))
+		if field.Type.Kind() == reflect.Bool {
+			value := &boolConfigFlag{}
+			configFlags.values[field.Name] = &value.configFlag
+			flagSet.Var(value, FlagName(field.Name), usage)
+		} else {
+			value := &configFlag{}
+			configFlags.values[field.Name] = value
+			flagSet.Var(value, FlagName(field.Name), usage)
+		}
+	}
+
+	return configFlags
+}
+
+// ApplyFlags overrides the configs by the flags given on the command line.
+func (context *Context) ApplyFlags(configFlags *ConfigFlags) error {
+	if configFlags == nil {
+		return nil
+	}
+
+	errs := []string{}
+	for _, field := range configFields() {
+		value, ok := configFlags.values[field.Name]
+		if !ok || !value.set {
+			continue
+		}
+
+		if err := context.Configs.setField(field, value.text); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid value %q for -%s: %v", value.text, FlagName(field.Name), err))
+			continue
+		}
+		context.Sources[field.Name] = SourceFlag
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// MarkDefaults records the fields changed from before as defaults.
+// A value given by an environment variable or a flag is never replaced silently.
+func (context *Context) MarkDefaults(before Configs) error {
+	errs := []string{}
+	beforeValue := reflect.ValueOf(before)
+	afterValue := reflect.ValueOf(context.Configs)
+	for _, field := range configFields() {
+		value := beforeValue.FieldByIndex(field.Index).Interface()
+		if value == afterValue.FieldByIndex(field.Index).Interface() {
+			continue
+		}
+
+		switch context.Sources[field.Name] {
+		case SourceEnv:
+			errs = append(errs, fmt.Sprintf("invalid value %v for %s: out of range", value, EnvName(field.Name)))
+		case SourceFlag:
+			errs = append(errs, fmt.Sprintf("invalid value %v for -%s: out of range", value, FlagName(field.Name)))
+		default:
+			context.Sources[field.Name] = SourceDefault
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// Validate checks the merged configs.
+func (configs *Configs) Validate() error {
+	errs := []string{}
+	invalid := func(field string, f string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf("%s (-%s, %s): %s", field, FlagName(field), EnvName(field), fmt.Sprintf(f, args...)))
+	}
+
+	for field, port := range map[string]int{"PoaServerPort": configs.PoaServerPort, "MqttPort": configs.MqttPort} {
+		if port < 0 || port > 65535 {
+			invalid(field, "port %d is out of range 0-65535", port)
+		}
+	}
+	for field, address := range map[string]string{"PoaServerAddress": configs.PoaServerAddress, "MqttBrokerAddress": configs.MqttBrokerAddress} {
+		if strings.Contains(address, "://") || strings.ContainsAny(address, " /") {
+			invalid(field, "%q must be a host name or an ip address without scheme or path", address)
+		}
+	}
+	if configs.SubnetPrefixLength < 1 || configs.SubnetPrefixLength > 32 {
+		invalid("SubnetPrefixLength", "%d is out of range 1-32", configs.SubnetPrefixLength)
+	}
+	for field, value := range map[string]int{
+		"UpdateCheckIntervalSec":      configs.UpdateCheckIntervalSec,
+		"RetentionDays":               configs.RetentionDays,
+		"RetentionCheckIntervalSec":   configs.RetentionCheckIntervalSec,
+		"CommandSignatureValiditySec": configs.CommandSignatureValiditySec,
+		"LogFileMaxSizeMB":            configs.LogFileMaxSizeMB,
+		"LogFileMaxAgeDays":           configs.LogFileMaxAgeDays,
+		"LogFileMaxBackups":           configs.LogFileMaxBackups,
+		"LogConsoleRecords":           configs.LogConsoleRecords,
+	} {
+		if value <= 0 {
+			invalid(field, "must be greater than 0")
+		}
+	}
+	if configs.RequiredAgentVersion != "" && !versionRegexp.MatchString(configs.RequiredAgentVersion) {
+		invalid("RequiredAgentVersion", "%q is not a version like v1.2.3", configs.RequiredAgentVersion)
+	}
+	for field, path := range map[string]string{
+		"CommandSigningKeyPath": configs.CommandSigningKeyPath,
+		"PayloadKeyPath":        configs.PayloadKeyPath,
+		"AccountsPath":          configs.AccountsPath,
+		"LogFilePath":           configs.LogFilePath,
+	} {
+		if strings.TrimSpace(path) == "" {
+			invalid(field, "path must not be empty")
+		}
+	}
+
+	if _, err := log.ParseFormat(configs.LogFormat); err != nil {
+		invalid("LogFormat", "%v, must be text or json", err)
+	}
+	if _, _, err := log.ParseLevels(configs.LogLevels); err != nil {
+		invalid("LogLevels", "%v, must be like info,manager=debug", err)
+	}
+	for _, output := range strings.Split(configs.LogOutputs, ",") {
+		switch strings.TrimSpace(output) {
+		case LogOutputStdout, LogOutputFile, LogOutputSyslog:
+		default:
+			invalid("LogOutputs", "unknown output %q, must be a list of stdout, file and syslog", output)
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New("invalid config:\n  " + strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// PrintConfig writes the effective configs with the source of each value.
+func (context *Context) PrintConfig(writer io.Writer) {
+	redacted := context.Configs
+	redacted.redact()
+
+	fmt.Fprintf(writer, "config file: %s\n\n", context.ConfigPath)
+
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "FIELD\tVALUE\tSOURCE")
+	value := reflect.ValueOf(redacted)
+	for _, field := range configFields() {
+		source := context.Sources[field.Name]
+		switch source {
+		case "":
+			source = "unset"
+		case SourceEnv:
+			source = ConfigSource(fmt.Sprintf("%s (%s)", SourceEnv, EnvName(field.Name)))
+		case SourceFlag:
+			source = ConfigSource(fmt.Sprintf("%s (-%s)", SourceFlag, FlagName(field.Name)))
+		}
+		fmt.Fprintf(table, "%s\t%v\t%s\n", field.Name, value.FieldByIndex(field.Index).Interface(), source)
+	}
+	table.Flush()
+}
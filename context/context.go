@@ -1,21 +1,41 @@
 package context
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"poa-manager/event"
 	"poa-manager/jsonWrapper"
+	"poa-manager/log"
+	"reflect"
 	"sync"
 )
 
+var logger log.Logger = log.NewLogger("context")
+
 type Context struct {
 	Version string
 
-	Configs     Configs
+	// merged from the defaults, the config file, the environment and the flags
+	Configs Configs
+	// the values of the config file, the only ones written back with the edited fields
+	fileConfigs Configs
+
+	ConfigPath string
+	// why the config file must not be overwritten, nil if it can be written
+	readOnly    error
+	Sources     map[string]ConfigSource
+	UnknownKeys []string
 	mutexConfig *sync.Mutex
 
 	EventLooper *event.EventLooper
 }
 
 type Configs struct {
+	ConfigVersion int
+
 	UpdateAddress          string
 	UpdateCheckIntervalSec int
 	PoaServerAddress       string
@@ -23,7 +43,35 @@ type Configs struct {
 	MqttBrokerAddress      string
 	MqttPort               int
 	MqttUser               string
-	MqttPassword           string
+	MqttPassword           string `json:",omitempty"`
+
+	AgentUpdateAddress   string
+	RequiredAgentVersion string
+
+	SubnetPrefixLength int
+
+	CommandSigningKeyPath       string
+	CommandSignatureValiditySec int
+
+	PayloadKeyPath string
+
+	AccountsPath string
+
+	RetentionEnabled          bool
+	RetentionDryRun           bool
+	RetentionDays             int
+	RetentionCheckIntervalSec int
+
+	LogLevels         string
+	LogFormat         string
+	LogOutputs        string
+	LogFilePath       string
+	LogFileMaxSizeMB  int
+	LogFileMaxAgeDays int
+	LogFileMaxBackups int
+	LogFileCompress   bool
+	LogSyslogAddress  string
+	LogConsoleRecords int
 }
 
 type DeviceType int
@@ -33,39 +81,227 @@ const (
 	DeviceTypeDeeper
 )
 
-func NewContext() *Context {
+func NewContext(configPath string) *Context {
 	context := Context{
 		// Configs: Configs{},
+		ConfigPath:  configPath,
+		Sources:     map[string]ConfigSource{},
 		mutexConfig: &sync.Mutex{},
 	}
-	context.Configs.ReadFile("config.json")
+	context.UnknownKeys, context.readOnly = context.Configs.ReadFile(configPath)
+	if context.readOnly != nil {
+		logger.LogfW("%s is not written: %v", configPath, context.readOnly)
+	}
+	context.fileConfigs = context.Configs
+
+	present := fileFields(configPath)
+	for _, field := range configFields() {
+		if present[field.Name] {
+			context.Sources[field.Name] = SourceFile
+		}
+	}
+
 	return &context
 }
 
-func (context *Context) WriteConfig() {
+// WriteConfig writes the config file with the given fields of the merged configs.
+// The other fields keep the values of the file, so the values of the defaults,
+// the environment and the flags are not written.
+// It returns an error without writing if the file could not be read as a config
+// of this version, see ConfigReadOnly.
+func (context *Context) WriteConfig(fields ...string) error {
+	if context.readOnly != nil {
+		return context.readOnly
+	}
+
+	context.mutexConfig.Lock()
+	context.fileConfigs = context.editedConfigs(fields)
+	context.mutexConfig.Unlock()
+
 	go func() {
 		context.mutexConfig.Lock()
-		context.Configs.WriteFile("config.json")
+		context.fileConfigs.WriteFile(context.ConfigPath)
 		context.mutexConfig.Unlock()
 	}()
+
+	return nil
+}
+
+// ConfigReadOnly returns why the config file is not written: it cannot be
+// parsed or migrated, or it is of a newer version. The settings of such a file
+// would be lost without a backup.
+func (context *Context) ConfigReadOnly() error {
+	return context.readOnly
+}
+
+// editedConfigs returns the values of the config file with the given fields of the merged configs.
+func (context *Context) editedConfigs(fields []string) Configs {
+	configs := context.fileConfigs
+	fileValue := reflect.ValueOf(&configs).Elem()
+	mergedValue := reflect.ValueOf(context.Configs)
+	for _, name := range fields {
+		field := fileValue.FieldByName(name)
+		if !field.IsValid() {
+			logger.LogfE("unknown config field: %s", name)
+			continue
+		}
+		field.Set(mergedValue.FieldByName(name))
+	}
+	return configs
 }
 
+// ChangedFields returns the names of the fields which differ.
+func ChangedFields(before, after Configs) []string {
+	fields := []string{}
+	beforeValue := reflect.ValueOf(before)
+	afterValue := reflect.ValueOf(after)
+	for _, field := range configFields() {
+		if beforeValue.FieldByIndex(field.Index).Interface() != afterValue.FieldByIndex(field.Index).Interface() {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
+
+// ResolvePath returns the path relative to the directory of the config file.
+func (context *Context) ResolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(context.ConfigPath), path)
+}
+
+// ToJson returns the configs with the secrets redacted.
 func (configs *Configs) ToJson() string {
+	redacted := *configs
+	redacted.redact()
+
 	jsonConfig := jsonWrapper.NewJsonWrapper()
-	if jsonConfig.MarshalValue(configs) {
+	if jsonConfig.MarshalValue(redacted) {
 		return jsonConfig.ToString()
 	}
 	return ""
 }
 
-func (configs *Configs) ReadFile(path string) {
+// ReadFile reads and migrates the config file.
+// It returns the keys of the file which are not settings of this version, and
+// an error if the file must not be overwritten.
+func (configs *Configs) ReadFile(path string) (unknownKeys []string, readOnly error) {
+	doc, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(doc, &values); err != nil {
+		logger.LogfE("cannot parse %s: %v", path, err)
+		return nil, fmt.Errorf("cannot parse the config file: %v", err)
+	}
+
+	version, migrated, err := migrateConfig(values)
+	if err != nil {
+		logger.LogfE("%s: %v", path, err)
+		return nil, err
+	}
+	if version > CurrentConfigVersion {
+		readOnly = fmt.Errorf("config version %d is newer than %d of this manager", version, CurrentConfigVersion)
+	}
+
+	unknownKeys = unknownConfigKeys(values)
+	for _, key := range unknownKeys {
+		logger.LogfW("unknown or obsolete config key %q in %s, it is not kept when the file is written", key, path)
+	}
+
+	migratedDoc, err := json.Marshal(values)
+	if err != nil {
+		logger.LogE(err)
+		return unknownKeys, err
+	}
+
+	file := configFile{}
 	jsonConfig := jsonWrapper.NewJsonWrapper()
-	jsonConfig.ReadJsonTo(path, configs)
+	jsonConfig.ParseJsonTo(string(migratedDoc), &file)
+	*configs = file.Configs
+
+	if file.Secrets != nil {
+		if err := configs.openSecrets(path, file.Secrets); errors.Is(err, ErrSecretsLocked) {
+			logger.LogfI("the secrets of %s are locked until the passphrase is entered", path)
+		} else if err != nil {
+			logger.LogfE("cannot decrypt the secrets of %s: %v", path, err)
+		}
+	}
+
+	if migrated {
+		// the file is rewritten only with a backup of the old version
+		backupPath := fmt.Sprintf("%s.v%d.bak", path, version)
+		if err := writeBackup(backupPath, doc); err != nil {
+			logger.LogfE("cannot back up %s: %v", path, err)
+			return unknownKeys, fmt.Errorf("cannot back up the config file before the migration: %v", err)
+		}
+
+		logger.LogfI("%s is upgraded to config version %d, the old file is kept in %s", path, CurrentConfigVersion, backupPath)
+		if err := configs.WriteFile(path); err != nil {
+			logger.LogfW("the secrets of %s are written when the config key is set", path)
+		}
+	} else if file.Secrets == nil && configs.hasSecrets() && readOnly == nil {
+		// plaintext secrets of an older config file, the file is left as it is
+		// until they can be encrypted
+		if _, err := configs.sealSecrets(path); err != nil {
+			logger.LogfW("the plaintext secrets of %s are encrypted when the config key is set: %v", path, err)
+		} else {
+			logger.LogfI("encrypting the plaintext secrets of %s", path)
+			configs.WriteFile(path)
+		}
+	}
+
+	return unknownKeys, readOnly
+}
+
+// writeBackup keeps the old config file without its plaintext secrets.
+func writeBackup(path string, doc []byte) error {
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(doc, &values); err != nil {
+		return err
+	}
+	for name := range (&Configs{}).secretValues() {
+		delete(values, name)
+	}
+
+	backup, err := json.MarshalIndent(values, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, backup, 0600)
 }
 
-func (configs *Configs) WriteFile(path string) {
+// WriteFile writes the configs with the secrets encrypted. If they cannot be
+// encrypted, the secrets are left out, the sealed ones of the file are kept,
+// and the error is returned.
+func (configs *Configs) WriteFile(path string) error {
+	file := configFile{Configs: *configs}
+	file.ConfigVersion = CurrentConfigVersion
+
+	section, sealErr := configs.sealSecrets(path)
+	if sealErr != nil {
+		logger.LogfE("the secrets are not written: %v", sealErr)
+		section = lockedSection(path)
+	}
+	file.Secrets = section
+	for _, value := range file.Configs.secretValues() {
+		*value = ""
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logger.LogE(err)
+		return err
+	}
+
 	jsonConfig := jsonWrapper.NewJsonWrapper()
-	if jsonConfig.MarshalValue(configs) {
+	if jsonConfig.MarshalValue(file) {
 		jsonConfig.WriteJson(path)
 	}
+
+	return sealErr
 }
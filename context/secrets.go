@@ -0,0 +1,352 @@
+package context
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"poa-manager/secrets"
+)
+
+const RedactedSecret = "********"
+
+const (
+	keySourceKeyring    = "keyring"
+	keySourcePassphrase = "passphrase"
+
+	passphraseIterations = 100000
+	passphraseAttempts   = 3
+)
+
+// secretSection is the encrypted part of the config file.
+// The key is kept in the os keyring or derived from a passphrase.
+type secretSection struct {
+	KeySource  string
+	Salt       []byte `json:",omitempty"`
+	Iterations int    `json:",omitempty"`
+	Values     map[string]string
+}
+
+// configFile is the layout of config.json
+type configFile struct {
+	Configs
+	Secrets *secretSection `json:",omitempty"`
+}
+
+// PassphrasePrompt asks the config passphrase while the config file is read,
+// on the terminal by default. The gui sets it to nil and asks with a dialog at
+// startup instead, see UnlockSecrets and SetSecretPassphrase.
+var PassphrasePrompt func(prompt string) (string, error) = secrets.ReadPassphrase
+
+var ErrSecretsLocked = errors.New("the config passphrase is not entered yet")
+
+var (
+	mutexSecretKey = &sync.Mutex{}
+	secretKey      []byte
+	secretPath     string
+	secretSource   secretSection
+	// sealed values which could not be decrypted, written back as they are
+	lockedSecrets map[string]string
+)
+
+// secretValues lists the fields which are encrypted in the config file.
+func (configs *Configs) secretValues() map[string]*string {
+	return map[string]*string{
+		"MqttPassword": &configs.MqttPassword,
+	}
+}
+
+func (configs *Configs) hasSecrets() bool {
+	for _, value := range configs.secretValues() {
+		if *value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (configs *Configs) redact() {
+	for _, value := range configs.secretValues() {
+		if *value != "" {
+			*value = RedactedSecret
+		}
+	}
+}
+
+func keyringAccount(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// openSecrets decrypts the secret section into the configs.
+func (configs *Configs) openSecrets(path string, section *secretSection) error {
+	mutexSecretKey.Lock()
+	defer mutexSecretKey.Unlock()
+
+	lockedSecrets = section.Values
+	secretKey = nil
+	secretPath = path
+	secretSource = secretSection{KeySource: section.KeySource, Salt: section.Salt, Iterations: section.Iterations}
+
+	open := func(key []byte) (map[string]string, error) {
+		return openValues(key, section.Values)
+	}
+
+	var key []byte
+	var values map[string]string
+	var err error
+
+	switch section.KeySource {
+	case keySourceKeyring:
+		var encoded string
+		if encoded, err = secrets.KeyringGet(keyringAccount(path)); err != nil {
+			return err
+		}
+		if key, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return err
+		}
+		values, err = open(key)
+
+	case keySourcePassphrase:
+		if PassphrasePrompt == nil {
+			return ErrSecretsLocked
+		}
+
+		attempts := passphraseAttempts
+		if os.Getenv(secrets.PassphraseEnv) != "" {
+			attempts = 1
+		}
+
+		for attempt := 0; attempt < attempts; attempt++ {
+			var passphrase string
+			if passphrase, err = PassphrasePrompt("config passphrase: "); err != nil {
+				return err
+			}
+
+			key = secrets.Pbkdf2([]byte(passphrase), section.Salt, section.Iterations, secrets.KeySize)
+			if values, err = open(key); err == nil {
+				break
+			}
+			logger.LogW("wrong config passphrase")
+		}
+
+	default:
+		return errors.New("unknown secret key source: " + section.KeySource)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for name, value := range configs.secretValues() {
+		*value = values[name]
+	}
+
+	secretKey = key
+	lockedSecrets = nil
+
+	return nil
+}
+
+func openValues(key []byte, sealedValues map[string]string) (map[string]string, error) {
+	values := map[string]string{}
+	for name, sealed := range sealedValues {
+		plain, err := secrets.Open(key, sealed)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = plain
+	}
+	return values, nil
+}
+
+// SecretsLocked reports if the secrets of the config file wait for the passphrase.
+func (context *Context) SecretsLocked() bool {
+	mutexSecretKey.Lock()
+	defer mutexSecretKey.Unlock()
+
+	return lockedSecrets != nil && secretSource.KeySource == keySourcePassphrase
+}
+
+// UnlockSecrets decrypts the secrets of the config file with the passphrase.
+// Values set by the environment or a flag are kept.
+func (context *Context) UnlockSecrets(passphrase string) error {
+	context.mutexConfig.Lock()
+	defer context.mutexConfig.Unlock()
+	mutexSecretKey.Lock()
+	defer mutexSecretKey.Unlock()
+
+	if lockedSecrets == nil || secretSource.KeySource != keySourcePassphrase {
+		return nil
+	}
+
+	key := secrets.Pbkdf2([]byte(passphrase), secretSource.Salt, secretSource.Iterations, secrets.KeySize)
+	values, err := openValues(key, lockedSecrets)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range context.fileConfigs.secretValues() {
+		*value = values[name]
+	}
+	for name, value := range context.Configs.secretValues() {
+		if source, ok := context.Sources[name]; !ok || source == SourceFile {
+			*value = values[name]
+		}
+	}
+
+	secretKey = key
+	lockedSecrets = nil
+
+	return nil
+}
+
+// SecretKeyNeeded reports if a passphrase has to be set before the config file is
+// written with the given fields, because there is no key yet and the os keyring
+// is not available.
+func (context *Context) SecretKeyNeeded(fields ...string) bool {
+	context.mutexConfig.Lock()
+	configs := context.editedConfigs(fields)
+	context.mutexConfig.Unlock()
+
+	mutexSecretKey.Lock()
+	defer mutexSecretKey.Unlock()
+
+	if context.ConfigPath != secretPath {
+		return configs.hasSecrets() && !secrets.KeyringAvailable()
+	}
+	return secretKey == nil && lockedSecrets == nil && configs.hasSecrets() && !secrets.KeyringAvailable()
+}
+
+// SetSecretPassphrase derives a new config key from the passphrase.
+func (context *Context) SetSecretPassphrase(passphrase string) error {
+	if passphrase == "" {
+		return secrets.ErrNoPassphrase
+	}
+
+	salt, err := secrets.RandomBytes(16)
+	if err != nil {
+		return err
+	}
+
+	mutexSecretKey.Lock()
+	defer mutexSecretKey.Unlock()
+
+	secretPath = context.ConfigPath
+	secretKey = secrets.Pbkdf2([]byte(passphrase), salt, passphraseIterations, secrets.KeySize)
+	secretSource = secretSection{KeySource: keySourcePassphrase, Salt: salt, Iterations: passphraseIterations}
+	lockedSecrets = nil
+
+	return nil
+}
+
+// lockedSection returns the sealed secrets of the file which are still locked,
+// nil if there are none.
+func lockedSection(path string) *secretSection {
+	mutexSecretKey.Lock()
+	defer mutexSecretKey.Unlock()
+
+	if path != secretPath || len(lockedSecrets) == 0 {
+		return nil
+	}
+
+	section := secretSource
+	section.Values = map[string]string{}
+	for name, sealed := range lockedSecrets {
+		section.Values[name] = sealed
+	}
+	return &section
+}
+
+// newSecretKey keeps a random key in the os keyring,
+// otherwise it asks a new passphrase to derive the key from.
+func newSecretKey(path string) error {
+	if secrets.KeyringAvailable() {
+		key, err := secrets.RandomBytes(secrets.KeySize)
+		if err != nil {
+			return err
+		}
+
+		if err = secrets.KeyringSet(keyringAccount(path), base64.StdEncoding.EncodeToString(key)); err == nil {
+			secretKey = key
+			secretSource = secretSection{KeySource: keySourceKeyring}
+			return nil
+		}
+		logger.LogfW("cannot store the config key in the os keyring: %v", err)
+	}
+
+	if PassphrasePrompt == nil {
+		return secrets.ErrNoPassphrase
+	}
+
+	passphrase, err := PassphrasePrompt("new config passphrase: ")
+	if err != nil {
+		return err
+	}
+	if confirm, err := PassphrasePrompt("repeat config passphrase: "); err != nil {
+		return err
+	} else if confirm != passphrase {
+		return errors.New("config passphrases do not match")
+	}
+
+	salt, err := secrets.RandomBytes(16)
+	if err != nil {
+		return err
+	}
+
+	secretKey = secrets.Pbkdf2([]byte(passphrase), salt, passphraseIterations, secrets.KeySize)
+	secretSource = secretSection{KeySource: keySourcePassphrase, Salt: salt, Iterations: passphraseIterations}
+
+	return nil
+}
+
+// sealSecrets returns the encrypted section for the secrets of the configs,
+// or nil if there is nothing to encrypt.
+func (configs *Configs) sealSecrets(path string) (*secretSection, error) {
+	mutexSecretKey.Lock()
+	defer mutexSecretKey.Unlock()
+
+	if path != secretPath {
+		secretKey = nil
+		lockedSecrets = nil
+		secretPath = path
+	}
+
+	if !configs.hasSecrets() && len(lockedSecrets) == 0 {
+		return nil, nil
+	}
+
+	if secretKey == nil && lockedSecrets == nil {
+		if err := newSecretKey(path); err != nil {
+			return nil, err
+		}
+	}
+
+	section := secretSource
+	section.Values = map[string]string{}
+	for name, value := range configs.secretValues() {
+		if *value == "" {
+			// the value is kept as it is if the key is not available
+			if sealed, ok := lockedSecrets[name]; ok {
+				section.Values[name] = sealed
+			}
+			continue
+		}
+
+		if secretKey == nil {
+			return nil, errors.New("the config key is not available to encrypt " + name)
+		}
+
+		sealed, err := secrets.Seal(secretKey, *value)
+		if err != nil {
+			return nil, err
+		}
+		section.Values[name] = sealed
+	}
+
+	return &section, nil
+}
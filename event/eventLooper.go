@@ -26,10 +26,16 @@ func NewEventLooper() *EventLooper {
 }
 
 func (evtLooper *EventLooper) RegisterEventHandler(evtType EventTarget, handler func(EventName, []interface{})) {
+	evtLooper.mutex.Lock()
+	defer evtLooper.mutex.Unlock()
+
 	evtLooper.listeners[evtType] = handler
 }
 
 func (evtLooper *EventLooper) PushEvent(target EventTarget, name EventName, args ...interface{}) {
+	evtLooper.mutex.Lock()
+	defer evtLooper.mutex.Unlock()
+
 	evtLooper.eventList.PushBack(Event{target: target, name: name, args: args})
 
 	evtLooper.cond.Signal()
@@ -43,10 +49,10 @@ func (evtLooper *EventLooper) Loop() {
 			if evtLooper.eventList.Len() > 0 {
 				element := evtLooper.eventList.Front()
 				evtLooper.eventList.Remove(element)
-				evtLooper.mutex.Unlock()
-
 				event := element.Value.(Event)
 				listener := evtLooper.listeners[event.target]
+				evtLooper.mutex.Unlock()
+
 				if listener != nil {
 					listener(event.name, event.args)
 				}
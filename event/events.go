@@ -13,4 +13,7 @@ const (
 	EVENT_MANAGER_DEVICE_MQTT_CHANGE_USER_PASSWORD
 	EVENT_MANAGER_DEVICE_FORCE_UPDATE
 	EVENT_MANAGER_DEVICE_CHANGE_UPDATE_ADDRESS
+	EVENT_MANAGER_DEVICE_CHANGE_INFO
+	EVENT_MANAGER_DEVICE_PUSH_CONFIG
+	EVENT_MANAGER_DEVICE_FORCE_UPDATE_DEVICES
 )
@@ -0,0 +1,190 @@
+package integration
+
+import (
+	"fmt"
+	"time"
+
+	"poa-manager/auth"
+	"poa-manager/context"
+	"poa-manager/event"
+	"poa-manager/log"
+	"poa-manager/manager"
+	"poa-manager/mockServer"
+	"poa-manager/simulator"
+)
+
+var logger log.Logger = log.NewLogger("integration")
+
+const (
+	simulatedDevices = 5
+	waitTimeout      = time.Second * 30
+)
+
+type check struct {
+	name string
+	run  func(env *environment) error
+}
+
+type environment struct {
+	server    *mockServer.MockServer
+	simulator *simulator.Simulator
+	manager   *manager.Manager
+
+	eventLooper *event.EventLooper
+
+	updatedCh chan int
+}
+
+// waitFor waits until the condition holds after a device list refresh of the manager.
+func (env *environment) waitFor(description string, cond func() bool) error {
+	timeout := time.After(waitTimeout)
+	for !cond() {
+		select {
+		case <-env.updatedCh:
+		case <-timeout:
+			return fmt.Errorf("timeout waiting for %s", description)
+		}
+	}
+
+	return nil
+}
+
+var checks = []check{
+	{"device list", func(env *environment) error {
+		return env.waitFor(fmt.Sprintf("%d devices", simulatedDevices), func() bool {
+			return len(env.manager.GetTotalDevices()) == simulatedDevices
+		})
+	}},
+	{"dead device", func(env *environment) error {
+		total, _ := env.server.Devices()
+		env.simulator.Kill(total[0].DeviceId, time.Hour)
+		env.server.SetLastSeen(total[0].DeviceId, time.Now().Add(-time.Hour))
+
+		return env.waitFor("a dead device", func() bool {
+			dead := env.manager.GetDeadDevices()
+			return len(dead) == 1 && dead[0].DeviceId == total[0].DeviceId
+		})
+	}},
+	{"remove device", func(env *environment) error {
+		dead := env.manager.GetDeadDevices()
+		if len(dead) == 0 {
+			return fmt.Errorf("no dead device to remove")
+		}
+		deviceId := dead[0].DeviceId
+		if ok, removedId := env.manager.RemoveDevices(deviceId); !ok || removedId != deviceId {
+			return fmt.Errorf("failed to remove %s", deviceId)
+		}
+
+		return env.waitFor("the removed device to disappear", func() bool {
+			return len(env.manager.GetTotalDevices()) == simulatedDevices-1 && env.manager.GetDevice(deviceId) == nil
+		})
+	}},
+	{"change info", func(env *environment) error {
+		total := env.manager.GetTotalDevices()
+		if len(total) == 0 {
+			return fmt.Errorf("no device to change")
+		}
+		deviceId := total[0].DeviceId
+		env.eventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_CHANGE_INFO, deviceId, "integration", 99, "changed by integration check")
+
+		return env.waitFor("the changed info", func() bool {
+			total, _ := env.server.Devices()
+			for _, device := range total {
+				if device.DeviceId == deviceId {
+					return device.Owner == "integration" && device.OwnNumber == 99
+				}
+			}
+			return false
+		})
+	}},
+}
+
+// start runs a mock PoA server, simulated agents and a manager on the configured mqtt broker.
+func start(poaContext *context.Context) (*environment, error) {
+	serverOptions := mockServer.DefaultOptions()
+	serverOptions.Port = 0
+	serverOptions.MqttBrokerAddress = poaContext.Configs.MqttBrokerAddress
+	serverOptions.MqttPort = poaContext.Configs.MqttPort
+	serverOptions.MqttUser = poaContext.Configs.MqttUser
+	serverOptions.MqttPassword = poaContext.Configs.MqttPassword
+
+	server := mockServer.NewMockServer(serverOptions)
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+
+	simulatorOptions := simulator.DefaultOptions()
+	simulatorOptions.Devices = simulatedDevices
+	simulatorOptions.Interval = time.Second
+	simulatorOptions.DeathRate = 0
+	simulatorOptions.MqttBrokerAddress = poaContext.Configs.MqttBrokerAddress
+	simulatorOptions.MqttPort = poaContext.Configs.MqttPort
+	simulatorOptions.MqttUser = poaContext.Configs.MqttUser
+	simulatorOptions.MqttPassword = poaContext.Configs.MqttPassword
+
+	sim := simulator.NewSimulator(simulatorOptions)
+	if err := sim.Start(); err != nil {
+		server.Stop()
+		return nil, err
+	}
+
+	// the manager talks to the mock server, the configs are not written back
+	poaContext.Configs.PoaServerAddress = serverOptions.Address
+	poaContext.Configs.PoaServerPort = server.Port()
+	poaContext.Configs.RetentionEnabled = false
+
+	eventLooper := event.NewEventLooper()
+	eventLooper.Loop()
+	poaContext.EventLooper = eventLooper
+
+	// the checks act on the manager without a logged in operator
+	auth.SetSystemSession("integration")
+
+	env := &environment{server: server, simulator: sim, manager: manager.NewManager(), eventLooper: eventLooper, updatedCh: make(chan int, 1)}
+	env.manager.Init(poaContext)
+	env.manager.Start()
+
+	go func() {
+		for {
+			env.manager.WaitUpdated()
+			select {
+			case env.updatedCh <- 0:
+			default:
+			}
+		}
+	}()
+
+	return env, nil
+}
+
+func (env *environment) stop() {
+	auth.Logout()
+	env.simulator.Stop()
+	env.server.Stop()
+}
+
+// Run starts a mock PoA server and simulated agents on the configured mqtt broker,
+// runs a manager against them and reports the failed checks.
+func Run(poaContext *context.Context) error {
+	env, err := start(poaContext)
+	if err != nil {
+		return err
+	}
+	defer env.stop()
+
+	failed := 0
+	for _, c := range checks {
+		if err := c.run(env); err != nil {
+			logger.LogfE("FAIL %s: %v", c.name, err)
+			failed++
+			continue
+		}
+		logger.LogfI("PASS %s", c.name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+
+	return nil
+}
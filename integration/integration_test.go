@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"poa-manager/context"
+
+	mqttServer "github.com/mochi-co/mqtt/server"
+	"github.com/mochi-co/mqtt/server/listeners"
+)
+
+// startBroker runs an in-process mqtt broker and returns its port.
+func startBroker(t *testing.T) int {
+	// the listener does not report its port, reserve a free one
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := reserved.Addr().(*net.TCPAddr).Port
+	reserved.Close()
+
+	broker := mqttServer.New()
+	if err := broker.AddListener(listeners.NewTCP("integration", reserved.Addr().String()), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		broker.Close()
+	})
+
+	return port
+}
+
+// newContext returns the configs main.Initialize would set, without a config file.
+func newContext(t *testing.T, brokerPort int) *context.Context {
+	poaContext := context.NewContext(filepath.Join(t.TempDir(), "config.json"))
+
+	configs := &poaContext.Configs
+	configs.MqttBrokerAddress = "127.0.0.1"
+	configs.MqttPort = brokerPort
+	configs.SubnetPrefixLength = 24
+	configs.CommandSigningKeyPath = "command_signing.key"
+	configs.CommandSignatureValiditySec = 300
+	configs.PayloadKeyPath = "payload_keys.json"
+	configs.AccountsPath = "accounts.json"
+	configs.UpdateCheckIntervalSec = 3600
+	configs.RetentionDays = 30
+	configs.RetentionCheckIntervalSec = 3600
+
+	return poaContext
+}
+
+func TestManager(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a broker, a mock server and simulated agents")
+	}
+
+	env, err := start(newContext(t, startBroker(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.stop()
+
+	// the checks build on each other like the -integration run, a failed one does not stop the others
+	for _, c := range checks {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.run(env); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const backupTimeFormat = "20060102-150405.000"
+
+// FileConfig rotates the log file when it exceeds MaxSizeMB or on a new day.
+// The rotated files older than MaxAgeDays or beyond MaxBackups are removed.
+type FileConfig struct {
+	Path       string
+	MaxSizeMB  int
+	MaxAgeDays int
+	MaxBackups int
+	Compress   bool
+}
+
+type fileSink struct {
+	config   FileConfig
+	format   Format
+	file     *os.File
+	size     int64
+	openDate string
+
+	// a failed rotation is not retried for every record
+	rotateRetry time.Time
+}
+
+const rotateRetryInterval = time.Minute
+
+func newFileSink(config FileConfig, format Format) (*fileSink, error) {
+	sink := &fileSink{config: config, format: format}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(sink.config.Path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(sink.config.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	sink.file = file
+	sink.size = stat.Size()
+	sink.openDate = stat.ModTime().Format("2006-01-02")
+	if sink.size == 0 {
+		sink.openDate = time.Now().Format("2006-01-02")
+	}
+
+	return nil
+}
+
+func (sink *fileSink) Write(record *Record) error {
+	line := format(record, sink.format) + "\n"
+
+	var rotateErr error
+	maxSize := int64(sink.config.MaxSizeMB) * 1024 * 1024
+	if sink.size > 0 && ((maxSize > 0 && sink.size+int64(len(line)) > maxSize) || sink.openDate != time.Now().Format("2006-01-02")) &&
+		time.Now().After(sink.rotateRetry) {
+		if rotateErr = sink.rotate(); rotateErr != nil {
+			sink.rotateRetry = time.Now().Add(rotateRetryInterval)
+		}
+	}
+	if sink.file == nil {
+		if err := sink.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := io.WriteString(sink.file, line)
+	sink.size += int64(n)
+	if rotateErr != nil {
+		return rotateErr
+	}
+	return err
+}
+
+func (sink *fileSink) Close() error {
+	if sink.file == nil {
+		return nil
+	}
+	err := sink.file.Close()
+	sink.file = nil
+	return err
+}
+
+func (sink *fileSink) rotate() error {
+	if err := sink.Close(); err != nil {
+		return err
+	}
+
+	backupPath := fmt.Sprintf("%s.%s", sink.config.Path, time.Now().Format(backupTimeFormat))
+	if err := os.Rename(sink.config.Path, backupPath); err != nil {
+		// keep logging to the current file, e.g. it is held open by another process on windows
+		if openErr := sink.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("cannot rotate the log file: %v", err)
+	}
+
+	if err := sink.open(); err != nil {
+		return err
+	}
+
+	go func() {
+		if sink.config.Compress {
+			if err := compressFile(backupPath); err != nil {
+				fmt.Fprintln(os.Stderr, "log:", err)
+			}
+		}
+		sink.removeOldBackups()
+	}()
+
+	return nil
+}
+
+func compressFile(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(target)
+	if _, err = io.Copy(writer, source); err == nil {
+		err = writer.Close()
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	source.Close()
+	return os.Remove(path)
+}
+
+// removeOldBackups keeps the rotated files within MaxAgeDays and MaxBackups.
+func (sink *fileSink) removeOldBackups() {
+	matches, err := filepath.Glob(sink.config.Path + ".*")
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		path string
+		time time.Time
+	}
+	backups := []backup{}
+	for _, path := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(path, sink.config.Path+"."), ".gz")
+		if backupTime, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local); err == nil {
+			backups = append(backups, backup{path, backupTime})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.After(backups[j].time) })
+
+	for i, backup := range backups {
+		expired := sink.config.MaxAgeDays > 0 && time.Since(backup.time) > time.Duration(sink.config.MaxAgeDays)*24*time.Hour
+		if expired || (sink.config.MaxBackups > 0 && i >= sink.config.MaxBackups) {
+			os.Remove(backup.path)
+		}
+	}
+}
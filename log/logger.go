@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"strings"
 	"time"
-
-	"github.com/fatih/color"
 )
 
 type any = interface{}
@@ -31,9 +29,13 @@ const (
 )
 
 type Logger struct {
-	Tag       string
-	Level     Level
+	Tag   string
+	Level Level
+	// prints the time in the text format, the json records always have it
 	Timestamp bool
+
+	// attached to every record, see With
+	fields map[string]any
 }
 
 func NewLogger(tag string) Logger {
@@ -61,110 +63,77 @@ func (log *Logger) ShowTimestamp(show bool) {
 	log.Timestamp = show
 }
 
-func (log *Logger) Print(level Level, f string, msg ...any) {
-	if log.Level <= level {
-		switch level {
-		case Verbose:
-			color.Set(color.FgCyan)
-		case Debug:
-			color.Set(color.FgWhite)
-		case Info:
-			color.Set(color.FgGreen)
-		case Warning:
-			color.Set(color.FgYellow)
-		case Error:
-			color.Set(color.FgRed)
-		case Fatal:
-			color.Set(color.FgHiMagenta)
+// With returns a logger which adds the key-value pairs to its records:
+// logger.With("device", deviceId, "topic", topic).LogE(err)
+func (log *Logger) With(keyvals ...any) *Logger {
+	fields := make(map[string]any, len(log.fields)+len(keyvals)/2)
+	for key, value := range log.fields {
+		fields[key] = value
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 < len(keyvals) {
+			fields[fmt.Sprint(keyvals[i])] = keyvals[i+1]
+		} else {
+			fields[fmt.Sprint(keyvals[i])] = nil
 		}
-
-		fmt.Printf(f, msg...)
-
-		color.Unset()
 	}
-}
 
-func (log *Logger) LogFormat(level Level, f string, msg ...any) {
-	if log.Level <= level {
-		var levelText string
-		var timeText string
+	child := *log
+	child.fields = fields
+	return &child
+}
 
-		if log.Timestamp {
-			timeText = time.Now().Local().Format("2006-01-02 15:04:05.06")
-		}
+// enabled checks the level against the level configured for the tag.
+func (log *Logger) enabled(level Level) bool {
+	return minLevel(log.Tag, log.Level) <= level
+}
 
-		switch level {
-		case Verbose:
-			color.Set(color.FgCyan)
-			levelText = strVerbose
-		case Debug:
-			color.Set(color.FgWhite)
-			levelText = strDebug
-		case Info:
-			color.Set(color.FgGreen)
-			levelText = strInfo
-		case Warning:
-			color.Set(color.FgYellow)
-			levelText = strWarning
-		case Error:
-			color.Set(color.FgRed)
-			levelText = strError
-		case Fatal:
-			color.Set(color.FgHiMagenta)
-			levelText = strFatal
-		}
+func (log *Logger) output(level Level, message string) {
+	record := Record{Time: time.Now(), Level: level, Tag: log.Tag, Message: message, Fields: log.fields, HideTime: !log.Timestamp}
+	write(&record)
+}
 
-		if log.Timestamp {
-			fmt.Printf("%s) %s [%s] ", timeText, levelText, log.Tag)
-		} else {
-			fmt.Printf("%s [%s] ", levelText, log.Tag)
-		}
-		fmt.Printf(f, msg...)
-		fmt.Println()
+func (log *Logger) Print(level Level, f string, msg ...any) {
+	if log.enabled(level) {
+		log.output(level, strings.TrimRight(fmt.Sprintf(f, msg...), "\n"))
+	}
+}
 
-		color.Unset()
+func (log *Logger) LogFormat(level Level, f string, msg ...any) {
+	if log.enabled(level) {
+		log.output(level, fmt.Sprintf(f, msg...))
 	}
 }
 
 func (log *Logger) Log(level Level, msg ...any) {
-	if log.Level <= level {
-		var levelText string
-		var timeText string
+	if log.enabled(level) {
+		log.output(level, fmt.Sprintf(strings.Repeat("%v", len(msg)), msg...))
+	}
+}
 
-		if log.Timestamp {
-			timeText = time.Now().Local().Format("2006-01-02 15:04:05.06")
-		}
+// Debug, Info, Warn and Error log the message with the key-value pairs as fields:
+// logger.With("device", deviceId).Info("info changed", "owner", owner)
+func (log *Logger) Debug(msg string, keyvals ...any) {
+	if log.enabled(Debug) {
+		log.With(keyvals...).output(Debug, msg)
+	}
+}
 
-		switch level {
-		case Verbose:
-			color.Set(color.FgCyan)
-			levelText = strVerbose
-		case Debug:
-			color.Set(color.FgWhite)
-			levelText = strDebug
-		case Info:
-			color.Set(color.FgGreen)
-			levelText = strInfo
-		case Warning:
-			color.Set(color.FgYellow)
-			levelText = strWarning
-		case Error:
-			color.Set(color.FgRed)
-			levelText = strError
-		case Fatal:
-			color.Set(color.FgHiMagenta)
-			levelText = strFatal
-		}
+func (log *Logger) Info(msg string, keyvals ...any) {
+	if log.enabled(Info) {
+		log.With(keyvals...).output(Info, msg)
+	}
+}
 
-		if log.Timestamp {
-			fmt.Printf("%s) %s [%s] ", timeText, levelText, log.Tag)
-		} else {
-			fmt.Printf("%s [%s] ", levelText, log.Tag)
-		}
-		fmt.Printf(strings.Repeat("%v", len(msg)), msg...)
-		fmt.Println()
+func (log *Logger) Warn(msg string, keyvals ...any) {
+	if log.enabled(Warning) {
+		log.With(keyvals...).output(Warning, msg)
+	}
+}
 
-		color.Unset()
+func (log *Logger) Error(msg string, keyvals ...any) {
+	if log.enabled(Error) {
+		log.With(keyvals...).output(Error, msg)
 	}
 }
 
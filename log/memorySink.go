@@ -0,0 +1,111 @@
+package log
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryRecord is a record kept by the memory sink, Seq increases with every record.
+type MemoryRecord struct {
+	Record
+	Seq uint64
+}
+
+// MemorySink keeps the last records in memory for the log console of the ui.
+type MemorySink struct {
+	// up to twice the size, the older ones are dropped in one copy, see kept
+	records []MemoryRecord
+	size    int
+	seq     uint64
+	mutex   *sync.Mutex
+}
+
+func NewMemorySink(size int) *MemorySink {
+	return &MemorySink{size: size, mutex: &sync.Mutex{}}
+}
+
+// SetSize changes the number of the kept records.
+func (sink *MemorySink) SetSize(size int) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.size = size
+	sink.records = append([]MemoryRecord{}, sink.kept()...)
+}
+
+// kept returns the last records within the size.
+func (sink *MemorySink) kept() []MemoryRecord {
+	if sink.size > 0 && len(sink.records) > sink.size {
+		return sink.records[len(sink.records)-sink.size:]
+	}
+	return sink.records
+}
+
+func (sink *MemorySink) Write(record *Record) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.seq++
+	sink.records = append(sink.records, MemoryRecord{Record: *record, Seq: sink.seq})
+	if sink.size > 0 && len(sink.records) > sink.size*2 {
+		sink.records = append([]MemoryRecord{}, sink.kept()...)
+	}
+
+	return nil
+}
+
+// Close keeps the records, the console still shows them after the sinks are replaced.
+func (sink *MemorySink) Close() error {
+	return nil
+}
+
+// Records returns the kept records newer than the sequence number.
+func (sink *MemorySink) Records(after uint64) []MemoryRecord {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	records := []MemoryRecord{}
+	for _, record := range sink.kept() {
+		if record.Seq > after {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
+
+// Tags returns the sorted tags of the kept records.
+func (sink *MemorySink) Tags() []string {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	found := map[string]bool{}
+	tags := []string{}
+	for _, record := range sink.kept() {
+		if !found[record.Tag] {
+			found[record.Tag] = true
+			tags = append(tags, record.Tag)
+		}
+	}
+	sort.Strings(tags)
+
+	return tags
+}
+
+// Clear removes the kept records.
+func (sink *MemorySink) Clear() {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.records = nil
+}
+
+// Text formats the record as the console lines.
+func (record *Record) Text() string {
+	return formatText(record)
+}
+
+// MessageText formats the tag, the message and the fields of the record.
+func (record *Record) MessageText() string {
+	return formatMessage(record)
+}
@@ -0,0 +1,334 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJson Format = "json"
+)
+
+// Record is a single log line passed to the sinks.
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Tag     string
+	Message string
+	Fields  map[string]any
+
+	// the text format omits the time, see Logger.Timestamp
+	HideTime bool
+}
+
+// Sink is an output of the log records.
+type Sink interface {
+	Write(record *Record) error
+	Close() error
+}
+
+// Config selects the sinks and the levels, see Configure.
+type Config struct {
+	Format  Format
+	Stdout  bool
+	File    *FileConfig
+	Syslog  *SyslogConfig
+	Memory  *MemorySink      // kept across Configure
+	Levels  map[string]Level // minimum level by tag
+	Default *Level           // minimum level of the other tags
+}
+
+var (
+	mutexSinks   = &sync.Mutex{}
+	sinks        = []Sink{&consoleSink{writer: os.Stdout, format: FormatText}}
+	tagLevels    = map[string]Level{}
+	defaultLevel *Level
+)
+
+var levelNames = map[Level]string{
+	Verbose: "verbose",
+	Debug:   "debug",
+	Info:    "info",
+	Warning: "warning",
+	Error:   "error",
+	Fatal:   "fatal",
+}
+
+func (level Level) String() string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(level))
+}
+
+func (level Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(level.String())
+}
+
+func ParseLevel(text string) (Level, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	for level, name := range levelNames {
+		if name == text || (text == "warn" && level == Warning) {
+			return level, nil
+		}
+	}
+	return Debug, fmt.Errorf("unknown log level %q", text)
+}
+
+// ParseLevels parses "info,manager=debug,mqtt=warning".
+// A level without tag is the default level of all the other tags.
+func ParseLevels(text string) (levels map[string]Level, defaultLevel *Level, err error) {
+	levels = map[string]Level{}
+	for _, item := range strings.Split(text, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		tag, levelText, found := strings.Cut(item, "=")
+		if !found {
+			levelText, tag = tag, ""
+		}
+
+		level, err := ParseLevel(levelText)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if tag = strings.TrimSpace(tag); tag == "" || tag == "default" {
+			defaultLevel = &level
+		} else {
+			levels[tag] = level
+		}
+	}
+
+	return levels, defaultLevel, nil
+}
+
+func ParseFormat(text string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(text))) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJson:
+		return FormatJson, nil
+	}
+	return FormatText, fmt.Errorf("unknown log format %q", text)
+}
+
+// Configure replaces the sinks. Without Configure the logs are printed to stdout as before.
+func Configure(config Config) error {
+	newSinks := []Sink{}
+	errs := []string{}
+
+	if config.Stdout {
+		newSinks = append(newSinks, &consoleSink{writer: os.Stdout, format: config.Format})
+	}
+	if config.File != nil {
+		if sink, err := newFileSink(*config.File, config.Format); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			newSinks = append(newSinks, sink)
+		}
+	}
+	if config.Syslog != nil {
+		if sink, err := newSyslogSink(*config.Syslog, config.Format); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			newSinks = append(newSinks, sink)
+		}
+	}
+
+	if len(newSinks) == 0 {
+		// never lose the logs
+		newSinks = append(newSinks, &consoleSink{writer: os.Stdout, format: config.Format})
+	}
+	if config.Memory != nil {
+		newSinks = append(newSinks, config.Memory)
+	}
+
+	mutexSinks.Lock()
+	oldSinks := sinks
+	sinks = newSinks
+	tagLevels = config.Levels
+	if tagLevels == nil {
+		tagLevels = map[string]Level{}
+	}
+	defaultLevel = config.Default
+	mutexSinks.Unlock()
+
+	for _, sink := range oldSinks {
+		sink.Close()
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// AddSink adds an output to the configured sinks.
+func AddSink(sink Sink) {
+	mutexSinks.Lock()
+	defer mutexSinks.Unlock()
+
+	sinks = append(sinks, sink)
+}
+
+// Close flushes and closes the sinks.
+func Close() {
+	mutexSinks.Lock()
+	defer mutexSinks.Unlock()
+
+	for _, sink := range sinks {
+		sink.Close()
+	}
+	sinks = []Sink{}
+}
+
+// minLevel returns the configured level of the tag.
+func minLevel(tag string, level Level) Level {
+	mutexSinks.Lock()
+	defer mutexSinks.Unlock()
+
+	if tagLevel, ok := tagLevels[tag]; ok {
+		return tagLevel
+	}
+	if defaultLevel != nil {
+		return *defaultLevel
+	}
+	return level
+}
+
+func write(record *Record) {
+	mutexSinks.Lock()
+	defer mutexSinks.Unlock()
+
+	for _, sink := range sinks {
+		if err := sink.Write(record); err != nil {
+			fmt.Fprintln(os.Stderr, "log:", err)
+		}
+	}
+}
+
+var levelTexts = map[Level]string{
+	Verbose: strVerbose,
+	Debug:   strDebug,
+	Info:    strInfo,
+	Warning: strWarning,
+	Error:   strError,
+	Fatal:   strFatal,
+}
+
+// formatText formats the record as the console lines.
+func formatText(record *Record) string {
+	if record.HideTime {
+		return fmt.Sprintf("%s %s", levelTexts[record.Level], formatMessage(record))
+	}
+	return fmt.Sprintf("%s) %s %s", record.Time.Local().Format("2006-01-02 15:04:05.06"), levelTexts[record.Level], formatMessage(record))
+}
+
+// formatMessage formats the tag, the message and the fields of the record.
+func formatMessage(record *Record) string {
+	builder := strings.Builder{}
+	builder.WriteString("[")
+	builder.WriteString(record.Tag)
+	builder.WriteString("] ")
+	builder.WriteString(record.Message)
+
+	keys := make([]string, 0, len(record.Fields))
+	for key := range record.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&builder, " %s=%v", key, record.Fields[key])
+	}
+
+	return builder.String()
+}
+
+type jsonRecord struct {
+	Time    string         `json:"time"`
+	Level   Level          `json:"level"`
+	Tag     string         `json:"tag"`
+	Message string         `json:"msg"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// formatJson formats the record as a json line.
+func formatJson(record *Record) string {
+	fields := map[string]any{}
+	for key, value := range record.Fields {
+		// errors have no exported fields
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fields[key] = value
+	}
+
+	doc, err := json.Marshal(jsonRecord{
+		Time:    record.Time.Format(time.RFC3339Nano),
+		Level:   record.Level,
+		Tag:     record.Tag,
+		Message: record.Message,
+		Fields:  fields,
+	})
+	if err != nil {
+		return fmt.Sprintf(`{"time":%q,"level":"error","tag":"log","msg":%q}`, record.Time.Format(time.RFC3339Nano), err.Error())
+	}
+	return string(doc)
+}
+
+func format(record *Record, format Format) string {
+	if format == FormatJson {
+		return formatJson(record)
+	}
+	return formatText(record)
+}
+
+type consoleSink struct {
+	writer io.Writer
+	format Format
+}
+
+func (sink *consoleSink) Write(record *Record) error {
+	if sink.format == FormatJson {
+		_, err := fmt.Fprintln(sink.writer, formatJson(record))
+		return err
+	}
+
+	switch record.Level {
+	case Verbose:
+		color.Set(color.FgCyan)
+	case Debug:
+		color.Set(color.FgWhite)
+	case Info:
+		color.Set(color.FgGreen)
+	case Warning:
+		color.Set(color.FgYellow)
+	case Error:
+		color.Set(color.FgRed)
+	case Fatal:
+		color.Set(color.FgHiMagenta)
+	}
+	defer color.Unset()
+
+	_, err := fmt.Fprintln(sink.writer, formatText(record))
+	return err
+}
+
+func (sink *consoleSink) Close() error {
+	return nil
+}
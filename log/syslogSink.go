@@ -0,0 +1,114 @@
+//go:build !windows && !plan9
+
+package log
+
+import (
+	"fmt"
+	"log/syslog"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	syslogQueueSize    = 1024
+	syslogCloseTimeout = 2 * time.Second
+)
+
+// SyslogConfig sends the logs to the local syslog if Address is empty,
+// otherwise to "udp://host:514" or "tcp://host:514".
+type SyslogConfig struct {
+	Address string
+	Tag     string
+}
+
+// syslogSink writes from its own goroutine, a stalled syslog server does not
+// block the loggers. The records are dropped while the queue is full.
+type syslogSink struct {
+	writer  *syslog.Writer
+	format  Format
+	records chan Record
+	done    chan struct{}
+	dropped int
+}
+
+func newSyslogSink(config SyslogConfig, format Format) (Sink, error) {
+	network, address := "", ""
+	if config.Address != "" {
+		network, address, _ = strings.Cut(config.Address, "://")
+	}
+
+	writer, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, config.Tag)
+	if err != nil {
+		return nil, err
+	}
+	sink := &syslogSink{writer: writer, format: format, records: make(chan Record, syslogQueueSize), done: make(chan struct{})}
+	go sink.run()
+
+	return sink, nil
+}
+
+// Write queues the record, called with mutexSinks locked.
+func (sink *syslogSink) Write(record *Record) error {
+	select {
+	case sink.records <- *record:
+		return nil
+	default:
+		sink.dropped++
+		if sink.dropped == 1 {
+			return fmt.Errorf("syslog is not responding, records are dropped")
+		}
+		return nil
+	}
+}
+
+func (sink *syslogSink) run() {
+	defer close(sink.done)
+
+	for record := range sink.records {
+		if err := sink.send(&record); err != nil {
+			fmt.Fprintln(os.Stderr, "log:", err)
+		}
+	}
+
+	if err := sink.writer.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "log:", err)
+	}
+}
+
+func (sink *syslogSink) send(record *Record) error {
+	// syslog adds its own timestamp and priority
+	line := formatMessage(record)
+	if sink.format == FormatJson {
+		line = formatJson(record)
+	}
+
+	switch record.Level {
+	case Verbose, Debug:
+		return sink.writer.Debug(line)
+	case Info:
+		return sink.writer.Info(line)
+	case Warning:
+		return sink.writer.Warning(line)
+	case Error:
+		return sink.writer.Err(line)
+	default:
+		return sink.writer.Crit(line)
+	}
+}
+
+// Close writes the queued records and closes the connection, waiting at most
+// syslogCloseTimeout for a stalled syslog.
+func (sink *syslogSink) Close() error {
+	close(sink.records)
+	if sink.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "log: %d records were dropped for syslog\n", sink.dropped)
+	}
+
+	select {
+	case <-sink.done:
+		return nil
+	case <-time.After(syslogCloseTimeout):
+		return fmt.Errorf("syslog is not responding, %d queued records are not written", len(sink.records))
+	}
+}
@@ -0,0 +1,12 @@
+package log
+
+import "errors"
+
+type SyslogConfig struct {
+	Address string
+	Tag     string
+}
+
+func newSyslogSink(config SyslogConfig, format Format) (Sink, error) {
+	return nil, errors.New("syslog is not supported on windows")
+}
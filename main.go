@@ -1,16 +1,24 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
+	"poa-manager/auth"
 	"poa-manager/context"
 	"poa-manager/event"
+	"poa-manager/integration"
 	"poa-manager/log"
 	"poa-manager/manager"
+	"poa-manager/mockServer"
 	"poa-manager/res"
+	"poa-manager/simulator"
 	"poa-manager/ui"
 	poaUpdater "poa-manager/updater"
 
@@ -25,6 +33,20 @@ const (
 	VERSION_NAME                          = "v0.3.3"
 	APPLICATION_UPDATE_ADDRESS            = "github.com/Minekorea1/poa-manager_go"
 	APPLICATION_UPDATE_CHECK_INTERVAL_SEC = 3600
+	DEVICE_RETENTION_DAYS                 = 30
+	DEVICE_RETENTION_CHECK_INTERVAL_SEC   = 3600
+	SUBNET_PREFIX_LENGTH                  = 24
+	COMMAND_SIGNING_KEY_PATH              = "command_signing.key"
+	COMMAND_SIGNATURE_VALIDITY_SEC        = 300
+	PAYLOAD_KEY_PATH                      = "payload_keys.json"
+	ACCOUNTS_PATH                         = "accounts.json"
+	LOG_FORMAT                            = "text"
+	LOG_OUTPUTS                           = "stdout"
+	LOG_FILE_PATH                         = "poa-manager.log"
+	LOG_FILE_MAX_SIZE_MB                  = 10
+	LOG_FILE_MAX_AGE_DAYS                 = 30
+	LOG_FILE_MAX_BACKUPS                  = 5
+	LOG_CONSOLE_RECORDS                   = 2000
 )
 
 func ternaryOP(cond bool, valTrue, valFalse interface{}) interface{} {
@@ -39,31 +61,242 @@ func emptyString(str string) bool {
 	return strings.TrimSpace(str) == ""
 }
 
-func Initialize() *context.Context {
-	context := context.NewContext()
+// Initialize merges the defaults, the config file, the POA_* environment variables
+// and the command line flags, in increasing priority.
+func Initialize(configPath string, configFlags *context.ConfigFlags) (*context.Context, error) {
+	context := context.NewContext(configPath)
+	if err := context.ApplyEnv(); err != nil {
+		return nil, err
+	}
+	if err := context.ApplyFlags(configFlags); err != nil {
+		return nil, err
+	}
+	configs := context.Configs
 
 	context.Version = VERSION_NAME
 	context.Configs.UpdateAddress = ternaryOP(emptyString(context.Configs.UpdateAddress),
 		APPLICATION_UPDATE_ADDRESS, context.Configs.UpdateAddress).(string)
 	context.Configs.UpdateCheckIntervalSec = ternaryOP(context.Configs.UpdateCheckIntervalSec <= 0,
 		APPLICATION_UPDATE_CHECK_INTERVAL_SEC, context.Configs.UpdateCheckIntervalSec).(int)
+	context.Configs.RetentionDays = ternaryOP(context.Configs.RetentionDays <= 0,
+		DEVICE_RETENTION_DAYS, context.Configs.RetentionDays).(int)
+	context.Configs.RetentionCheckIntervalSec = ternaryOP(context.Configs.RetentionCheckIntervalSec <= 0,
+		DEVICE_RETENTION_CHECK_INTERVAL_SEC, context.Configs.RetentionCheckIntervalSec).(int)
+	context.Configs.SubnetPrefixLength = ternaryOP(context.Configs.SubnetPrefixLength <= 0 || context.Configs.SubnetPrefixLength > 32,
+		SUBNET_PREFIX_LENGTH, context.Configs.SubnetPrefixLength).(int)
+	context.Configs.CommandSigningKeyPath = ternaryOP(emptyString(context.Configs.CommandSigningKeyPath),
+		COMMAND_SIGNING_KEY_PATH, context.Configs.CommandSigningKeyPath).(string)
+	context.Configs.CommandSignatureValiditySec = ternaryOP(context.Configs.CommandSignatureValiditySec <= 0,
+		COMMAND_SIGNATURE_VALIDITY_SEC, context.Configs.CommandSignatureValiditySec).(int)
+	context.Configs.PayloadKeyPath = ternaryOP(emptyString(context.Configs.PayloadKeyPath),
+		PAYLOAD_KEY_PATH, context.Configs.PayloadKeyPath).(string)
+	context.Configs.AccountsPath = ternaryOP(emptyString(context.Configs.AccountsPath),
+		ACCOUNTS_PATH, context.Configs.AccountsPath).(string)
+	context.Configs.LogFormat = ternaryOP(emptyString(context.Configs.LogFormat),
+		LOG_FORMAT, context.Configs.LogFormat).(string)
+	context.Configs.LogOutputs = ternaryOP(emptyString(context.Configs.LogOutputs),
+		LOG_OUTPUTS, context.Configs.LogOutputs).(string)
+	context.Configs.LogFilePath = ternaryOP(emptyString(context.Configs.LogFilePath),
+		LOG_FILE_PATH, context.Configs.LogFilePath).(string)
+	context.Configs.LogFileMaxSizeMB = ternaryOP(context.Configs.LogFileMaxSizeMB <= 0,
+		LOG_FILE_MAX_SIZE_MB, context.Configs.LogFileMaxSizeMB).(int)
+	context.Configs.LogFileMaxAgeDays = ternaryOP(context.Configs.LogFileMaxAgeDays <= 0,
+		LOG_FILE_MAX_AGE_DAYS, context.Configs.LogFileMaxAgeDays).(int)
+	context.Configs.LogFileMaxBackups = ternaryOP(context.Configs.LogFileMaxBackups <= 0,
+		LOG_FILE_MAX_BACKUPS, context.Configs.LogFileMaxBackups).(int)
+	context.Configs.LogConsoleRecords = ternaryOP(context.Configs.LogConsoleRecords <= 0,
+		LOG_CONSOLE_RECORDS, context.Configs.LogConsoleRecords).(int)
+	if err := context.MarkDefaults(configs); err != nil {
+		return nil, err
+	}
+
+	if err := context.Configs.Validate(); err != nil {
+		return nil, err
+	}
+
+	return context, nil
+}
+
+// configureLogging sets the log sinks and the levels of the config.
+// The records of the memory sink are shown by the log console of the ui.
+func configureLogging(poaContext *context.Context, logRecords *log.MemorySink) error {
+	configs := poaContext.Configs
+
+	format, _ := log.ParseFormat(configs.LogFormat)
+	levels, defaultLevel, _ := log.ParseLevels(configs.LogLevels)
+	config := log.Config{Format: format, Levels: levels, Default: defaultLevel, Memory: logRecords}
+	logRecords.SetSize(configs.LogConsoleRecords)
+
+	for _, output := range strings.Split(configs.LogOutputs, ",") {
+		switch strings.TrimSpace(output) {
+		case context.LogOutputStdout:
+			config.Stdout = true
+		case context.LogOutputFile:
+			config.File = &log.FileConfig{
+				Path:       poaContext.ResolvePath(configs.LogFilePath),
+				MaxSizeMB:  configs.LogFileMaxSizeMB,
+				MaxAgeDays: configs.LogFileMaxAgeDays,
+				MaxBackups: configs.LogFileMaxBackups,
+				Compress:   configs.LogFileCompress,
+			}
+		case context.LogOutputSyslog:
+			config.Syslog = &log.SyslogConfig{Address: configs.LogSyslogAddress, Tag: "poa-manager"}
+		}
+	}
+
+	return log.Configure(config)
+}
+
+func runSimulator(context *context.Context, devices int, intervalSec int, verifyKeyPath string, payloadKeyPath string) {
+	if intervalSec <= 0 {
+		logger.LogfE("-simulate-interval must be greater than 0: %d", intervalSec)
+		os.Exit(2)
+	}
+
+	options := simulator.DefaultOptions()
+	options.Devices = devices
+	options.Interval = time.Second * time.Duration(intervalSec)
+	options.MqttBrokerAddress = ternaryOP(emptyString(context.Configs.MqttBrokerAddress),
+		options.MqttBrokerAddress, context.Configs.MqttBrokerAddress).(string)
+	options.MqttPort = ternaryOP(context.Configs.MqttPort <= 0, options.MqttPort, context.Configs.MqttPort).(int)
+	options.MqttUser = context.Configs.MqttUser
+	options.MqttPassword = context.Configs.MqttPassword
+
+	if verifyKeyPath != "" {
+		doc, err := os.ReadFile(verifyKeyPath)
+		if err == nil {
+			options.VerifyKey, err = manager.ParsePublicKey(doc)
+		}
+		if err != nil {
+			logger.LogE(err)
+			os.Exit(1)
+		}
+	}
+
+	if payloadKeyPath != "" {
+		doc, err := os.ReadFile(payloadKeyPath)
+		if err == nil {
+			options.PayloadKey = &manager.PayloadKey{}
+			err = json.Unmarshal(doc, options.PayloadKey)
+		}
+		if err != nil {
+			logger.LogE(err)
+			os.Exit(1)
+		}
+	}
+
+	sim := simulator.NewSimulator(options)
+	if err := sim.Start(); err != nil {
+		logger.LogE(err)
+		os.Exit(1)
+	}
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	<-signalCh
 
-	return context
+	sim.Stop()
+}
+
+func runMockServer(context *context.Context) {
+	options := mockServer.DefaultOptions()
+	options.Port = ternaryOP(context.Configs.PoaServerPort <= 0, options.Port, context.Configs.PoaServerPort).(int)
+	options.MqttBrokerAddress = context.Configs.MqttBrokerAddress
+	options.MqttPort = ternaryOP(context.Configs.MqttPort <= 0, options.MqttPort, context.Configs.MqttPort).(int)
+	options.MqttUser = context.Configs.MqttUser
+	options.MqttPassword = context.Configs.MqttPassword
+
+	server := mockServer.NewMockServer(options)
+	if err := server.Start(); err != nil {
+		logger.LogE(err)
+		os.Exit(1)
+	}
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	<-signalCh
+
+	server.Stop()
 }
 
 func main() {
 	versionFlag := false
+	configPath := ""
+	printConfigFlag := false
+	simulateDevices := 0
+	simulateIntervalSec := 0
+	simulateVerifyKeyPath := ""
+	simulatePayloadKeyPath := ""
+	mockServerFlag := false
+	integrationFlag := false
+	recordPath := ""
+	replayPath := ""
+	replaySpeed := 1.0
 	flag.BoolVar(&versionFlag, "version", false, "prints the version and exit")
+	flag.StringVar(&configPath, "config", context.DefaultConfigPath(), "config file path (env "+context.ConfigPathEnv+")")
+	flag.BoolVar(&printConfigFlag, "print-config", false, "prints the effective config with the source of each value and exit")
+	flag.IntVar(&simulateDevices, "simulate", 0, "runs the given number of virtual PoA agents against the mqtt broker instead of the manager")
+	flag.IntVar(&simulateIntervalSec, "simulate-interval", 10, "info report interval of the virtual agents in seconds")
+	flag.StringVar(&simulateVerifyKeyPath, "simulate-verify-key", "", "public key file the virtual agents verify the command signatures with")
+	flag.StringVar(&simulatePayloadKeyPath, "simulate-payload-key", "", "payload key file the virtual agents encrypt their payloads with")
+	flag.BoolVar(&mockServerFlag, "mock-server", false, "runs an in-memory PoA server fed by poa/info messages of the mqtt broker instead of the manager")
+	flag.BoolVar(&integrationFlag, "integration", false, "runs the manager against a mock server and simulated agents on the mqtt broker and exit")
+	flag.StringVar(&recordPath, "record", "", "records the received mqtt messages to the file")
+	flag.StringVar(&replayPath, "replay", "", "feeds the recorded mqtt messages of the file into the manager instead of connecting to the mqtt broker")
+	flag.Float64Var(&replaySpeed, "replay-speed", 1, "replay speed multiplier, 0 replays as fast as possible")
+	configFlags := context.RegisterConfigFlags(flag.CommandLine)
 	flag.Parse()
 
+	// keeps the logs from the start, the windows build has no console to print them
+	logRecords := log.NewMemorySink(LOG_CONSOLE_RECORDS)
+	log.AddSink(logRecords)
+
 	if versionFlag {
 		fmt.Println(VERSION_NAME)
 		return
 	}
 
-	logger.Print(log.Info, "version: %s\n", VERSION_NAME)
+	if !printConfigFlag && !integrationFlag && !mockServerFlag && simulateDevices == 0 {
+		// the gui asks the config passphrase with a dialog, see ui.AskPassphrase
+		context.PassphrasePrompt = nil
+	}
+
+	context, err := Initialize(configPath, configFlags)
+	if err != nil {
+		logger.LogE(err)
+		os.Exit(2)
+	}
+
+	if printConfigFlag {
+		context.PrintConfig(os.Stdout)
+		return
+	}
 
-	context := Initialize()
+	if err := configureLogging(context, logRecords); err != nil {
+		logger.LogE(err)
+	}
+	defer log.Close()
+
+	if integrationFlag {
+		if err := integration.Run(context); err != nil {
+			logger.LogE(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if mockServerFlag {
+		runMockServer(context)
+		return
+	}
+
+	if simulateDevices > 0 {
+		runSimulator(context, simulateDevices, simulateIntervalSec, simulateVerifyKeyPath, simulatePayloadKeyPath)
+		return
+	}
+
+	logger.Print(log.Info, "version: %s\n", VERSION_NAME)
+	logger.LogfI("config: %s", context.ConfigPath)
 
 	eventLooper := event.NewEventLooper()
 	eventLooper.Loop()
@@ -75,7 +308,20 @@ func main() {
 
 	manager := manager.NewManager()
 	manager.Init(context)
-	manager.Start()
+	if recordPath != "" {
+		if err := manager.StartRecording(recordPath); err != nil {
+			logger.LogE(err)
+		}
+	}
+	if replayPath != "" {
+		manager.SetReplay(replayPath, replaySpeed)
+	}
+
+	accounts, err := auth.LoadAccounts(context.ResolvePath(context.Configs.AccountsPath))
+	if err != nil {
+		logger.LogE(err)
+		return
+	}
 
 	// ui
 	os.Setenv("FYNE_THEME", "light") // light or dark
@@ -92,14 +338,18 @@ func main() {
 	a.Settings().SetTheme(&ui.MyTheme{})
 	win.SetMaster()
 
-	ui.Init(&a, &win, context, manager)
+	ui.Init(&a, &win, context, manager, accounts, logRecords)
 	uiMenu := ui.Menu{}
 	subContent := container.NewMax()
 
 	// mainContent := container.NewHSplit(uiMenu.MakeMenu(), uiStatus.GetContainer())
 	// mainContent.Offset = 0.2
 	mainContent := container.NewBorder(nil, nil, uiMenu.MakeMenu(subContent), nil, subContent)
-	win.SetContent(mainContent)
+	ui.ShowLogin(func() {
+		win.SetContent(mainContent)
+	})
+	// the mqtt password may wait for the config passphrase
+	ui.AskPassphrase(manager.Start)
 	win.Resize(fyne.NewSize(1120, 720))
 	ui.RunUpdateThread()
 	win.ShowAndRun()
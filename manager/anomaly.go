@@ -0,0 +1,185 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type IssueKind int
+
+const (
+	IssueDuplicateMac IssueKind = iota
+	IssueDuplicateOwnNumber
+	IssueDuplicatePrivateIp
+	IssueMacChanged
+)
+
+type Issue struct {
+	Kind        IssueKind
+	Description string
+	Devices     []DeviceInfo
+
+	// suggested action, the device which looks stale among the duplicates
+	Suggestion    string
+	StaleDeviceId string
+
+	// set for IssueMacChanged
+	MacChange *MacChange
+}
+
+type MacChange struct {
+	DeviceId  string
+	OldMac    string
+	NewMac    string
+	Timestamp int64
+}
+
+type identityTracker struct {
+	macs       map[string]string
+	macChanges []MacChange
+	mutex      *sync.Mutex
+}
+
+// trackIdentity remembers the mac address of the device and records a change.
+func (manager *Manager) trackIdentity(device *DeviceInfo) {
+	if device.DeviceId == "" || device.MacAddress == "" {
+		return
+	}
+
+	tracker := &manager.identityTracker
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	oldMac, ok := tracker.macs[device.DeviceId]
+	if ok && !strings.EqualFold(oldMac, device.MacAddress) {
+		tracker.macChanges = append(tracker.macChanges, MacChange{
+			DeviceId:  device.DeviceId,
+			OldMac:    oldMac,
+			NewMac:    device.MacAddress,
+			Timestamp: time.Now().Unix(),
+		})
+		logger.With("device", device.DeviceId).LogfW("mac address changed: %s, %s -> %s", device.DeviceId, oldMac, device.MacAddress)
+	}
+	tracker.macs[device.DeviceId] = device.MacAddress
+}
+
+// DismissMacChange removes the recorded mac changes of the device.
+func (manager *Manager) DismissMacChange(deviceId string) {
+	tracker := &manager.identityTracker
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	macChanges := []MacChange{}
+	for _, change := range tracker.macChanges {
+		if change.DeviceId != deviceId {
+			macChanges = append(macChanges, change)
+		}
+	}
+	tracker.macChanges = macChanges
+}
+
+// DetectIssues looks for duplicated identities among the registered devices
+// and for devices whose mac address has changed.
+func (manager *Manager) DetectIssues() []Issue {
+	issues := []Issue{}
+
+	groupBy := func(key func(device *DeviceInfo) string) [][]*DeviceInfo {
+		groups := map[string][]*DeviceInfo{}
+		keys := []string{}
+		for _, device := range manager.GetTotalDevices() {
+			k := key(device)
+			if k == "" {
+				continue
+			}
+			if _, ok := groups[k]; !ok {
+				keys = append(keys, k)
+			}
+			groups[k] = append(groups[k], device)
+		}
+		sort.Strings(keys)
+
+		duplicates := [][]*DeviceInfo{}
+		for _, k := range keys {
+			if len(groups[k]) > 1 {
+				duplicates = append(duplicates, groups[k])
+			}
+		}
+		return duplicates
+	}
+
+	for _, devices := range groupBy(func(device *DeviceInfo) string {
+		return strings.ToLower(device.MacAddress)
+	}) {
+		issues = append(issues, newDuplicateIssue(IssueDuplicateMac,
+			fmt.Sprintf("맥주소 %s 를 %d 개의 장치가 사용합니다.", devices[0].MacAddress, len(devices)), devices))
+	}
+
+	for _, devices := range groupBy(func(device *DeviceInfo) string {
+		if device.Owner == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s\x00%d", device.Owner, device.OwnNumber)
+	}) {
+		issues = append(issues, newDuplicateIssue(IssueDuplicateOwnNumber,
+			fmt.Sprintf("%s[%d] 를 %d 개의 장치가 사용합니다.", devices[0].Owner, devices[0].OwnNumber, len(devices)), devices))
+	}
+
+	for _, devices := range groupBy(func(device *DeviceInfo) string {
+		if device.PublicIp == "" || device.PrivateIp == "" {
+			return ""
+		}
+		return device.PublicIp + "/" + device.PrivateIp
+	}) {
+		issues = append(issues, newDuplicateIssue(IssueDuplicatePrivateIp,
+			fmt.Sprintf("%s 네트워크의 내부IP %s 를 %d 개의 장치가 사용합니다.", devices[0].PublicIp, devices[0].PrivateIp, len(devices)), devices))
+	}
+
+	manager.identityTracker.mutex.Lock()
+	macChanges := make([]MacChange, len(manager.identityTracker.macChanges))
+	copy(macChanges, manager.identityTracker.macChanges)
+	manager.identityTracker.mutex.Unlock()
+
+	for i := range macChanges {
+		change := macChanges[i]
+		issue := Issue{
+			Kind: IssueMacChanged,
+			Description: fmt.Sprintf("장치 %s 의 맥주소가 변경되었습니다: %s -> %s (%s)", change.DeviceId, change.OldMac, change.NewMac,
+				time.Unix(change.Timestamp, 0).Format("2006-01-02 15:04:05")),
+			Suggestion: "장치가 교체되었거나 고유번호가 복제되었는지 확인해 주세요.",
+			MacChange:  &change,
+		}
+		if device := manager.GetDevice(change.DeviceId); device != nil {
+			issue.Devices = []DeviceInfo{*device}
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues
+}
+
+// newDuplicateIssue suggests removing the device which was seen least recently,
+// preferring dead devices.
+func newDuplicateIssue(kind IssueKind, description string, devices []*DeviceInfo) Issue {
+	issue := Issue{Kind: kind, Description: description}
+
+	var stale *DeviceInfo
+	for _, device := range devices {
+		issue.Devices = append(issue.Devices, *device)
+
+		if stale == nil ||
+			(stale.Alive && !device.Alive) ||
+			(stale.Alive == device.Alive && device.Timestamp < stale.Timestamp) {
+			stale = device
+		}
+	}
+
+	if stale != nil {
+		issue.StaleDeviceId = stale.DeviceId
+		issue.Suggestion = fmt.Sprintf("가장 오래 통신이 없는 장치 %s[%d] (%s) 를 목록에서 제거하세요.", stale.Owner, stale.OwnNumber, stale.DeviceId)
+	}
+
+	return issue
+}
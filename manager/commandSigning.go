@@ -0,0 +1,274 @@
+package manager
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"poa-manager/auth"
+	"poa-manager/context"
+)
+
+// signature parameters of a command, part of the signed payload.
+type Signature struct {
+	KeyId  string
+	Target string // device id, a command is not valid for other devices
+	Nonce  string
+	Expiry int64
+}
+
+// SignedCommand is published on the command topic. Signature is the base64 ed25519
+// signature of the bytes of Payload, the json of the Command, so the agents verify
+// the payload as received without serializing the command again.
+type SignedCommand struct {
+	Payload   string
+	Signature string
+}
+
+type commandSigner struct {
+	path        string
+	validitySec int
+
+	privateKey ed25519.PrivateKey
+	keyId      string
+	mutex      *sync.Mutex
+}
+
+// KeyId identifies the public key, the first 8 bytes of its sha256 in hex.
+func KeyId(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (manager *Manager) initCommandSigner(poaContext *context.Context) {
+	manager.signer = commandSigner{
+		path:        poaContext.ResolvePath(poaContext.Configs.CommandSigningKeyPath),
+		validitySec: poaContext.Configs.CommandSignatureValiditySec,
+		mutex:       &sync.Mutex{},
+	}
+
+	if err := manager.signer.load(); err != nil {
+		logger.LogE(err)
+	}
+}
+
+// load reads the private key, creating a new key pair if the file does not exist.
+func (signer *commandSigner) load() error {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+
+	doc, err := os.ReadFile(signer.path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.LogfI("create command signing key: %s", signer.path)
+		return signer.generate()
+	} else if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(doc)
+	if block == nil {
+		return fmt.Errorf("no pem data in %s", signer.path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return fmt.Errorf("not an ed25519 key: %s", signer.path)
+	}
+
+	signer.privateKey = privateKey
+	signer.keyId = KeyId(privateKey.Public().(ed25519.PublicKey))
+
+	return nil
+}
+
+func (signer *commandSigner) generate() error {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(signer.path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return err
+	}
+
+	signer.privateKey = privateKey
+	signer.keyId = KeyId(privateKey.Public().(ed25519.PublicKey))
+
+	return nil
+}
+
+// sign adds the signature parameters for the target device to the command and
+// returns the signed command to publish.
+func (signer *commandSigner) sign(command *Command, target string) ([]byte, error) {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+
+	if signer.privateKey == nil {
+		return nil, errors.New("no command signing key")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	command.Signature = &Signature{
+		KeyId:  signer.keyId,
+		Target: target,
+		Nonce:  hex.EncodeToString(nonce),
+		Expiry: time.Now().Add(time.Second * time.Duration(signer.validitySec)).Unix(),
+	}
+
+	payload, err := json.MarshalIndent(command, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(SignedCommand{
+		Payload:   string(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(signer.privateKey, payload)),
+	}, "", "    ")
+}
+
+// UnwrapCommand returns the command of a signed command without verifying it.
+func UnwrapCommand(doc []byte) (Command, error) {
+	signed := SignedCommand{}
+	if err := json.Unmarshal(doc, &signed); err != nil {
+		return Command{}, err
+	}
+	if signed.Payload == "" {
+		return Command{}, errors.New("command is not signed")
+	}
+
+	command := Command{}
+	if err := json.Unmarshal([]byte(signed.Payload), &command); err != nil {
+		return Command{}, err
+	}
+
+	return command, nil
+}
+
+// VerifyCommand checks the signature, target and expiry of a received signed command.
+// Replays within the expiry are detected by the agent remembering the nonces.
+func VerifyCommand(publicKey ed25519.PublicKey, target string, doc []byte) (Command, error) {
+	signed := SignedCommand{}
+	if err := json.Unmarshal(doc, &signed); err != nil {
+		return Command{}, err
+	}
+	if signed.Payload == "" || signed.Signature == "" {
+		return Command{}, errors.New("command is not signed")
+	}
+
+	value, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return Command{}, err
+	}
+	if !ed25519.Verify(publicKey, []byte(signed.Payload), value) {
+		return Command{}, errors.New("invalid signature")
+	}
+
+	command := Command{}
+	if err := json.Unmarshal([]byte(signed.Payload), &command); err != nil {
+		return Command{}, err
+	}
+	if command.Signature == nil {
+		return Command{}, errors.New("command has no signature parameters")
+	}
+	if command.Signature.KeyId != KeyId(publicKey) {
+		return Command{}, fmt.Errorf("unknown signing key: %s", command.Signature.KeyId)
+	}
+	if command.Signature.Target != target {
+		return Command{}, fmt.Errorf("command is signed for %s", command.Signature.Target)
+	}
+	if command.Signature.Expiry < time.Now().Unix() {
+		return Command{}, errors.New("command is expired")
+	}
+
+	return command, nil
+}
+
+// ParsePublicKey reads a pem encoded public key exported by ExportPublicKey.
+func ParsePublicKey(doc []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(doc)
+	if block == nil {
+		return nil, errors.New("no pem data")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an ed25519 public key")
+	}
+
+	return publicKey, nil
+}
+
+// SigningKeyId returns the id of the current command signing key.
+func (manager *Manager) SigningKeyId() string {
+	manager.signer.mutex.Lock()
+	defer manager.signer.mutex.Unlock()
+
+	return manager.signer.keyId
+}
+
+// ExportPublicKey returns the pem encoded public key for the agents.
+func (manager *Manager) ExportPublicKey() ([]byte, error) {
+	manager.signer.mutex.Lock()
+	defer manager.signer.mutex.Unlock()
+
+	if manager.signer.privateKey == nil {
+		return nil, errors.New("no command signing key")
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(manager.signer.privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// RotateSigningKey replaces the key pair, keeping the old private key as a backup file.
+func (manager *Manager) RotateSigningKey() error {
+	if err := auth.Check(auth.PermissionKeys); err != nil {
+		return err
+	}
+
+	signer := &manager.signer
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+
+	if _, err := os.Stat(signer.path); err == nil {
+		backupPath := fmt.Sprintf("%s.%s", signer.path, time.Now().Format("20060102150405"))
+		if err := os.Rename(signer.path, backupPath); err != nil {
+			return err
+		}
+		logger.LogfI("old command signing key moved to %s", backupPath)
+	}
+
+	if err := signer.generate(); err != nil {
+		return err
+	}
+	logger.LogfI("command signing key rotated: %s", signer.keyId)
+
+	return nil
+}
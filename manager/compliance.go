@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"sort"
+
+	"poa-manager/updater"
+)
+
+type VersionGroup struct {
+	Version string
+	Devices []*DeviceInfo
+
+	BelowRequired bool
+	BehindLatest  bool
+}
+
+func (group *VersionGroup) Outdated() bool {
+	return group.BelowRequired || group.BehindLatest
+}
+
+type ComplianceReport struct {
+	Required string
+	Latest   string
+
+	Groups   []VersionGroup
+	Outdated []*DeviceInfo
+}
+
+// VersionCompliance groups the devices by version and compares each version with
+// the required minimum and the latest release. Empty versions are not compared.
+func (manager *Manager) VersionCompliance(required, latest string) ComplianceReport {
+	report := ComplianceReport{Required: required, Latest: latest}
+
+	groups := map[string]*VersionGroup{}
+	for _, device := range manager.GetTotalDevices() {
+		group, ok := groups[device.Version]
+		if !ok {
+			group = &VersionGroup{
+				Version:       device.Version,
+				BelowRequired: required != "" && updater.IsOlderVersion(device.Version, required),
+				BehindLatest:  latest != "" && updater.IsOlderVersion(device.Version, latest),
+			}
+			groups[device.Version] = group
+		}
+		group.Devices = append(group.Devices, device)
+
+		if group.Outdated() {
+			report.Outdated = append(report.Outdated, device)
+		}
+	}
+
+	for _, group := range groups {
+		report.Groups = append(report.Groups, *group)
+	}
+
+	// newest version first
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if updater.IsOlderVersion(report.Groups[j].Version, report.Groups[i].Version) {
+			return true
+		}
+		if updater.IsOlderVersion(report.Groups[i].Version, report.Groups[j].Version) {
+			return false
+		}
+		return report.Groups[i].Version > report.Groups[j].Version
+	})
+
+	return report
+}
@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogRequest struct {
+	RequestId  string `json:"RequestId,omitempty"`
+	ReplyTopic string `json:"ReplyTopic,omitempty"`
+	Lines      int    `json:"Lines,omitempty"`
+	Since      int64  `json:"Since,omitempty"`
+	Until      int64  `json:"Until,omitempty"`
+}
+
+// client to server, published on the reply topic of the log request
+type LogChunk struct {
+	RequestId string
+	Seq       int
+	Total     int
+	Data      string
+	Error     string `json:"Error,omitempty"`
+}
+
+type DeviceLog struct {
+	RequestId   string
+	DeviceId    string
+	RequestTime int64
+
+	Received int
+	Total    int
+	Complete bool
+	Error    string
+
+	chunks map[int]string
+}
+
+type deviceLogs struct {
+	logs  map[string]*DeviceLog
+	mutex *sync.Mutex
+}
+
+var logReplyTopicRegexp = regexp.MustCompile("mine/[0-9]+\\.[0-9]+\\.[0-9]+\\.[0-9]+/.+/poa/log/.+")
+
+func newRequestId() string {
+	return fmt.Sprintf("%d%04d", time.Now().UnixNano(), rand.Intn(10000))
+}
+
+// Text returns the received chunks joined in order.
+func (deviceLog *DeviceLog) Text() string {
+	builder := strings.Builder{}
+	for seq := 0; seq < deviceLog.Total; seq++ {
+		builder.WriteString(deviceLog.chunks[seq])
+	}
+
+	return builder.String()
+}
+
+// RequestDeviceLog asks the device for the last lines of its agent log, or the
+// lines between since and until if lines is 0. The answer arrives in chunks and
+// can be read with GetDeviceLog.
+func (manager *Manager) RequestDeviceLog(deviceId string, lines int, since, until int64) (string, error) {
+	device := manager.GetDevice(deviceId)
+	if device == nil {
+		return "", fmt.Errorf("unknown device: %s", deviceId)
+	}
+
+	requestId := newRequestId()
+	request := LogRequest{
+		RequestId:  requestId,
+		ReplyTopic: fmt.Sprintf("mine/%s/%s/poa/log/%s", device.PublicIp, device.DeviceId, requestId),
+		Lines:      lines,
+		Since:      since,
+		Until:      until,
+	}
+
+	manager.deviceLogs.mutex.Lock()
+	manager.deviceLogs.logs[requestId] = &DeviceLog{RequestId: requestId, DeviceId: deviceId, RequestTime: time.Now().Unix(), chunks: map[int]string{}}
+	manager.deviceLogs.mutex.Unlock()
+
+	if err := manager.publishCommand(device, Command{Type: CommandLog, Log: &request}); err != nil {
+		manager.deviceLogs.mutex.Lock()
+		delete(manager.deviceLogs.logs, requestId)
+		manager.deviceLogs.mutex.Unlock()
+
+		return "", err
+	}
+
+	return requestId, nil
+}
+
+func (manager *Manager) receiveLogChunk(topic string, payload []byte) {
+	chunk := LogChunk{}
+	if err := json.Unmarshal(payload, &chunk); err != nil {
+		topicLogger(topic).LogE(err)
+		return
+	}
+
+	manager.deviceLogs.mutex.Lock()
+	defer manager.deviceLogs.mutex.Unlock()
+
+	chunkLogger := topicLogger(topic).With("command", CommandLog, "request", chunk.RequestId)
+	deviceLog, ok := manager.deviceLogs.logs[chunk.RequestId]
+	if !ok {
+		chunkLogger.LogD("unknown log request: ", chunk.RequestId)
+		return
+	}
+	// the request id is not a secret, only the requested device answers
+	if TopicDeviceId(topic) != deviceLog.DeviceId {
+		chunkLogger.LogfW("log chunk from another device, requested: %s", deviceLog.DeviceId)
+		return
+	}
+
+	if chunk.Error != "" {
+		deviceLog.Error = chunk.Error
+		deviceLog.Complete = true
+		return
+	}
+
+	if chunk.Total <= 0 || chunk.Seq < 0 || chunk.Seq >= chunk.Total {
+		chunkLogger.LogfW("invalid log chunk %d of %d", chunk.Seq, chunk.Total)
+		return
+	}
+	if deviceLog.Total > 0 && chunk.Total != deviceLog.Total {
+		chunkLogger.LogfW("log chunk total changed from %d to %d", deviceLog.Total, chunk.Total)
+		return
+	}
+
+	deviceLog.Total = chunk.Total
+	if _, ok := deviceLog.chunks[chunk.Seq]; !ok {
+		deviceLog.chunks[chunk.Seq] = chunk.Data
+		deviceLog.Received++
+	}
+	deviceLog.Complete = deviceLog.Total > 0 && deviceLog.Received >= deviceLog.Total
+}
+
+// GetDeviceLog returns a copy of the log received so far for the request.
+func (manager *Manager) GetDeviceLog(requestId string) (DeviceLog, bool) {
+	manager.deviceLogs.mutex.Lock()
+	defer manager.deviceLogs.mutex.Unlock()
+
+	deviceLog, ok := manager.deviceLogs.logs[requestId]
+	if !ok {
+		return DeviceLog{}, false
+	}
+
+	copied := *deviceLog
+	copied.chunks = map[int]string{}
+	for seq, data := range deviceLog.chunks {
+		copied.chunks[seq] = data
+	}
+
+	return copied, true
+}
+
+// ReleaseDeviceLog drops the received log once the viewer is closed.
+func (manager *Manager) ReleaseDeviceLog(requestId string) {
+	manager.deviceLogs.mutex.Lock()
+	delete(manager.deviceLogs.logs, requestId)
+	manager.deviceLogs.mutex.Unlock()
+}
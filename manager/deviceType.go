@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"fmt"
+
+	"poa-manager/context"
+)
+
+// command types of the Command struct
+const (
+	CommandRestart = "restart"
+	CommandMqtt    = "mqtt"
+	CommandUpdate  = "update"
+	CommandInfo    = "info"
+	CommandConfig  = "config"
+	CommandLog     = "log"
+	CommandDiag    = "diag"
+	CommandWol     = "wol"
+	CommandKey     = "key"
+)
+
+// a device specific value reported in DeviceInfo.Extra
+type DetailField struct {
+	Key   string
+	Label string
+}
+
+type DeviceTypeInfo struct {
+	Type  context.DeviceType
+	Name  string
+	Badge string
+	// theme icon name, resolved by the ui
+	Icon string
+
+	Commands     []string
+	DetailFields []DetailField
+}
+
+var deviceTypes = map[context.DeviceType]DeviceTypeInfo{
+	context.DeviceTypeNormal: {
+		Type:     context.DeviceTypeNormal,
+		Name:     "일반",
+		Badge:    "PoA",
+		Icon:     "computer",
+		Commands: []string{CommandRestart, CommandMqtt, CommandUpdate, CommandInfo, CommandConfig, CommandLog, CommandDiag, CommandWol, CommandKey},
+	},
+	context.DeviceTypeDeeper: {
+		Type:     context.DeviceTypeDeeper,
+		Name:     "Deeper",
+		Badge:    "Deeper",
+		Icon:     "storage",
+		Commands: []string{CommandRestart, CommandMqtt, CommandUpdate, CommandInfo, CommandLog},
+		DetailFields: []DetailField{
+			{Key: "Model", Label: "모델"},
+			{Key: "Firmware", Label: "펌웨어"},
+			{Key: "Channel", Label: "채널"},
+		},
+	},
+}
+
+// RegisterDeviceType adds or replaces a device type description.
+func RegisterDeviceType(typeInfo DeviceTypeInfo) {
+	deviceTypes[typeInfo.Type] = typeInfo
+}
+
+// GetDeviceType returns the description of the device type. Unknown types
+// are described as normal devices so that they keep the basic commands.
+func GetDeviceType(deviceType int) DeviceTypeInfo {
+	if typeInfo, ok := deviceTypes[context.DeviceType(deviceType)]; ok {
+		return typeInfo
+	}
+
+	typeInfo := deviceTypes[context.DeviceTypeNormal]
+	typeInfo.Type = context.DeviceType(deviceType)
+	typeInfo.Name = fmt.Sprintf("알 수 없음(%d)", deviceType)
+	typeInfo.Badge = "?"
+
+	return typeInfo
+}
+
+func (typeInfo DeviceTypeInfo) Supports(commandType string) bool {
+	for _, command := range typeInfo.Commands {
+		if command == commandType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func SupportsCommand(device *DeviceInfo, commandType string) bool {
+	return GetDeviceType(device.DeviceType).Supports(commandType)
+}
@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+type DiagKind string
+
+// only these diagnostics are sent to the agents, anything else is rejected before publishing
+const (
+	DiagPing       DiagKind = "ping"
+	DiagDns        DiagKind = "dns"
+	DiagRoute      DiagKind = "route"
+	DiagInterfaces DiagKind = "interfaces"
+	DiagDisk       DiagKind = "disk"
+)
+
+type DiagDescriptor struct {
+	Kind        DiagKind
+	Name        string
+	NeedsTarget bool
+}
+
+var Diagnostics = []DiagDescriptor{
+	{Kind: DiagPing, Name: "핑", NeedsTarget: true},
+	{Kind: DiagDns, Name: "이름 확인(DNS)", NeedsTarget: true},
+	{Kind: DiagRoute, Name: "라우팅 테이블"},
+	{Kind: DiagInterfaces, Name: "네트워크 인터페이스"},
+	{Kind: DiagDisk, Name: "디스크 사용량"},
+}
+
+type DiagRequest struct {
+	RequestId  string   `json:"RequestId,omitempty"`
+	ReplyTopic string   `json:"ReplyTopic,omitempty"`
+	Kind       DiagKind `json:"Kind,omitempty"`
+	Target     string   `json:"Target,omitempty"`
+}
+
+// client to server, published on the reply topic of the diag request
+type DiagResult struct {
+	RequestId  string
+	Kind       DiagKind
+	Target     string
+	Success    bool
+	DurationMs int64
+	Values     map[string]string `json:"Values,omitempty"`
+	Output     string            `json:"Output,omitempty"`
+	Error      string            `json:"Error,omitempty"`
+}
+
+type DiagRun struct {
+	Request     DiagRequest
+	DeviceId    string
+	RequestTime int64
+
+	Received bool
+	Result   DiagResult
+}
+
+type diagnostics struct {
+	runs  map[string]*DiagRun
+	mutex *sync.Mutex
+}
+
+var (
+	diagReplyTopicRegexp = regexp.MustCompile("mine/[0-9]+\\.[0-9]+\\.[0-9]+\\.[0-9]+/.+/poa/diag/.+")
+	diagTargetRegexp     = regexp.MustCompile("^[A-Za-z0-9]([A-Za-z0-9.:-]{0,252})$")
+)
+
+func findDiagnostic(kind DiagKind) (DiagDescriptor, bool) {
+	for _, descriptor := range Diagnostics {
+		if descriptor.Kind == kind {
+			return descriptor, true
+		}
+	}
+
+	return DiagDescriptor{}, false
+}
+
+// ValidateDiagnostic checks the kind against the whitelist and the target
+// against a host name or ip address pattern.
+func ValidateDiagnostic(kind DiagKind, target string) error {
+	descriptor, ok := findDiagnostic(kind)
+	if !ok {
+		return fmt.Errorf("unsupported diagnostic: %s", kind)
+	}
+
+	if descriptor.NeedsTarget {
+		if !diagTargetRegexp.MatchString(target) {
+			return fmt.Errorf("invalid target: %q", target)
+		}
+	} else if target != "" {
+		return fmt.Errorf("%s does not take a target", kind)
+	}
+
+	return nil
+}
+
+// RunDiagnostic sends a diag command to the device. The result can be read with GetDiagRun.
+func (manager *Manager) RunDiagnostic(deviceId string, kind DiagKind, target string) (string, error) {
+	if err := ValidateDiagnostic(kind, target); err != nil {
+		return "", err
+	}
+
+	device := manager.GetDevice(deviceId)
+	if device == nil {
+		return "", fmt.Errorf("unknown device: %s", deviceId)
+	}
+
+	requestId := newRequestId()
+	request := DiagRequest{
+		RequestId:  requestId,
+		ReplyTopic: fmt.Sprintf("mine/%s/%s/poa/diag/%s", device.PublicIp, device.DeviceId, requestId),
+		Kind:       kind,
+		Target:     target,
+	}
+
+	manager.diagnostics.mutex.Lock()
+	manager.diagnostics.runs[requestId] = &DiagRun{Request: request, DeviceId: deviceId, RequestTime: time.Now().Unix()}
+	manager.diagnostics.mutex.Unlock()
+
+	if err := manager.publishCommand(device, Command{Type: CommandDiag, Diag: &request}); err != nil {
+		manager.diagnostics.mutex.Lock()
+		delete(manager.diagnostics.runs, requestId)
+		manager.diagnostics.mutex.Unlock()
+
+		return "", err
+	}
+
+	return requestId, nil
+}
+
+func (manager *Manager) receiveDiagResult(topic string, payload []byte) {
+	result := DiagResult{}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		topicLogger(topic).LogE(err)
+		return
+	}
+
+	manager.diagnostics.mutex.Lock()
+	defer manager.diagnostics.mutex.Unlock()
+
+	resultLogger := topicLogger(topic).With("command", CommandDiag, "request", result.RequestId)
+	run, ok := manager.diagnostics.runs[result.RequestId]
+	if !ok {
+		resultLogger.LogD("unknown diag request: ", result.RequestId)
+		return
+	}
+	// the request id is not a secret, only the requested device answers
+	if TopicDeviceId(topic) != run.DeviceId {
+		resultLogger.LogfW("diag result from another device, requested: %s", run.DeviceId)
+		return
+	}
+
+	run.Result = result
+	run.Received = true
+}
+
+// GetDiagRun returns the diagnostic request and its result if it has arrived.
+func (manager *Manager) GetDiagRun(requestId string) (DiagRun, bool) {
+	manager.diagnostics.mutex.Lock()
+	defer manager.diagnostics.mutex.Unlock()
+
+	run, ok := manager.diagnostics.runs[requestId]
+	if !ok {
+		return DiagRun{}, false
+	}
+
+	return *run, true
+}
+
+func (manager *Manager) ReleaseDiagRun(requestId string) {
+	manager.diagnostics.mutex.Lock()
+	delete(manager.diagnostics.runs, requestId)
+	manager.diagnostics.mutex.Unlock()
+}
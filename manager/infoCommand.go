@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"poa-manager/auth"
+	"poa-manager/context"
+)
+
+// metadata change requested to a device, confirmed by its next poa/info
+type PendingInfo struct {
+	Info        Info
+	RequestTime int64
+	Confirmed   bool
+	ConfirmTime int64
+}
+
+func (manager *Manager) publishCommand(device *DeviceInfo, command Command) error {
+	return manager.publishCommandKey(device, command, nil)
+}
+
+// publishCommandKey sends the command encrypted with the payload key, or with
+// the key of the device if it is nil.
+func (manager *Manager) publishCommandKey(device *DeviceInfo, command Command, key *PayloadKey) error {
+	if err := auth.Check(auth.PermissionCommand); err != nil {
+		return err
+	}
+	if !SupportsCommand(device, command.Type) {
+		return fmt.Errorf("%s command is not supported by %s device: %s", command.Type, GetDeviceType(device.DeviceType).Name, device.DeviceId)
+	}
+	command.SchemaVersion = CommandSchemaVersion
+	doc, err := manager.signer.sign(&command, device.DeviceId)
+	if err != nil {
+		return err
+	}
+
+	cmdAddress := fmt.Sprintf("mine/%s/%s/poa/command", device.PublicIp, device.DeviceId)
+
+	commandLogger(device, command.Type).With("topic", cmdAddress).LogD("cmdAddress:", cmdAddress, " <- ", redactCommand(command))
+
+	if doc, err = manager.encryptCommand(device, cmdAddress, doc, key); err != nil {
+		return err
+	}
+
+	token := manager.mqttClient.Publish(cmdAddress, manager.mqttQos, false, string(doc))
+	token.Wait()
+
+	return token.Error()
+}
+
+// redactCommand returns the command document for the log without the mqtt password
+// and the payload key.
+func redactCommand(command Command) string {
+	if command.Mqtt != nil && command.Mqtt.MqttPassword != "" {
+		mqtt := *command.Mqtt
+		mqtt.MqttPassword = context.RedactedSecret
+		command.Mqtt = &mqtt
+	}
+	if command.Key != nil {
+		// the key id is kept to follow the rotation
+		key := PayloadKey{KeyId: command.Key.KeyId}
+		command.Key = &key
+	}
+
+	redacted, err := json.MarshalIndent(command, "", "    ")
+	if err != nil {
+		return ""
+	}
+	return string(redacted)
+}
+
+// publishCommandAll sends the command to every alive device supporting it.
+func (manager *Manager) publishCommandAll(command Command) {
+	for _, device := range manager.GetTotalDevices() {
+		if device.Alive && SupportsCommand(device, command.Type) {
+			if err := manager.publishCommand(device, command); err != nil {
+				commandLogger(device, command.Type).LogE(err)
+			}
+		}
+	}
+}
+
+func (manager *Manager) requestInfoChange(deviceId string, info Info) {
+	device := manager.GetDevice(deviceId)
+	if device == nil {
+		logger.With("device", deviceId, "command", CommandInfo).LogE("unknown device: ", deviceId)
+		return
+	}
+
+	command := Command{Type: CommandInfo, Info: &info}
+	if err := manager.publishCommand(device, command); err != nil {
+		commandLogger(device, command.Type).LogE(err)
+		return
+	}
+
+	manager.mutexPendingInfo.Lock()
+	manager.pendingInfos[deviceId] = &PendingInfo{Info: info, RequestTime: time.Now().Unix()}
+	manager.mutexPendingInfo.Unlock()
+}
+
+func (manager *Manager) confirmPendingInfo(deviceInfo *DeviceInfo) {
+	manager.mutexPendingInfo.Lock()
+	defer manager.mutexPendingInfo.Unlock()
+
+	pending, ok := manager.pendingInfos[deviceInfo.DeviceId]
+	if !ok || pending.Confirmed {
+		return
+	}
+
+	if deviceInfo.Owner == pending.Info.Owner &&
+		deviceInfo.OwnNumber == pending.Info.OwnNumber &&
+		deviceInfo.DeviceDesc == pending.Info.DeviceDesc {
+		pending.Confirmed = true
+		pending.ConfirmTime = time.Now().Unix()
+
+		logger.With("device", deviceInfo.DeviceId, "command", CommandInfo).LogfI("device info change confirmed: %s", deviceInfo.DeviceId)
+	}
+}
+
+// GetPendingInfo returns the last metadata change requested to the device.
+func (manager *Manager) GetPendingInfo(deviceId string) (PendingInfo, bool) {
+	manager.mutexPendingInfo.Lock()
+	defer manager.mutexPendingInfo.Unlock()
+
+	pending, ok := manager.pendingInfos[deviceId]
+	if !ok {
+		return PendingInfo{}, false
+	}
+
+	return *pending, true
+}
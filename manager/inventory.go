@@ -0,0 +1,309 @@
+package manager
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ExportFormat string
+
+const (
+	ExportFormatCsv  ExportFormat = "csv"
+	ExportFormatJson ExportFormat = "json"
+	ExportFormatXlsx ExportFormat = "xlsx"
+)
+
+var ExportFormats = []ExportFormat{ExportFormatCsv, ExportFormatJson, ExportFormatXlsx}
+
+var inventoryHeader = []string{"Owner", "OwnNumber", "DeviceDesc", "DeviceId", "PublicIp", "PrivateIp", "MacAddress", "Version", "LastContact", "Alive"}
+
+// a row of the inventory spreadsheet
+type InventoryItem struct {
+	Owner       string
+	OwnNumber   int
+	DeviceDesc  string
+	DeviceId    string
+	PublicIp    string
+	PrivateIp   string
+	MacAddress  string
+	Version     string
+	LastContact string
+	Alive       bool
+}
+
+// a device expected to be registered, read from an imported csv
+type ExpectedDevice struct {
+	DeviceId   string
+	MacAddress string
+	Owner      string
+	OwnNumber  int
+}
+
+type InventoryMismatch struct {
+	Expected ExpectedDevice
+	Device   DeviceInfo
+}
+
+type ReconcileReport struct {
+	Missing    []ExpectedDevice
+	Unexpected []DeviceInfo
+	Mismatched []InventoryMismatch
+	Matched    int
+}
+
+func NewInventoryItem(device *DeviceInfo) InventoryItem {
+	return InventoryItem{
+		Owner:       device.Owner,
+		OwnNumber:   device.OwnNumber,
+		DeviceDesc:  device.DeviceDesc,
+		DeviceId:    device.DeviceId,
+		PublicIp:    device.PublicIp,
+		PrivateIp:   device.PrivateIp,
+		MacAddress:  device.MacAddress,
+		Version:     device.Version,
+		LastContact: time.Unix(device.Timestamp, 0).Format("2006-01-02 15:04:05"),
+		Alive:       device.Alive,
+	}
+}
+
+func (item InventoryItem) row() []string {
+	return []string{item.Owner, strconv.Itoa(item.OwnNumber), item.DeviceDesc, item.DeviceId, item.PublicIp,
+		item.PrivateIp, item.MacAddress, item.Version, item.LastContact, strconv.FormatBool(item.Alive)}
+}
+
+// ExportDevices writes the devices to w in the given format.
+func ExportDevices(w io.Writer, format ExportFormat, devices []*DeviceInfo) error {
+	items := []InventoryItem{}
+	for _, device := range devices {
+		items = append(items, NewInventoryItem(device))
+	}
+
+	switch format {
+	case ExportFormatCsv:
+		return exportCsv(w, items)
+	case ExportFormatJson:
+		return exportJson(w, items)
+	case ExportFormatXlsx:
+		return exportXlsx(w, items)
+	}
+
+	return fmt.Errorf("unknown export format: %s", format)
+}
+
+func exportCsv(w io.Writer, items []InventoryItem) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(inventoryHeader); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := writer.Write(item.row()); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func exportJson(w io.Writer, items []InventoryItem) error {
+	doc, err := json.MarshalIndent(items, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(doc)
+
+	return err
+}
+
+// exportXlsx writes a minimal single sheet workbook with inline strings.
+func exportXlsx(w io.Writer, items []InventoryItem) error {
+	rows := [][]string{inventoryHeader}
+	for _, item := range items {
+		rows = append(rows, item.row())
+	}
+
+	sheet := &strings.Builder{}
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(sheet, `<row r="%d">`, r+1)
+		for c, value := range row {
+			fmt.Fprintf(sheet, `<c r="%s%d" t="inlineStr"><is><t>%s</t></is></c>`, xlsxColumn(c), r+1, xlsxEscape(value))
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	files := []struct {
+		name string
+		body string
+	}{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Devices" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, file.body); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func xlsxColumn(index int) (column string) {
+	for index++; index > 0; index = (index - 1) / 26 {
+		column = string(rune('A'+(index-1)%26)) + column
+	}
+
+	return
+}
+
+func xlsxEscape(value string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;").Replace(value)
+}
+
+// ParseExpectedDevices reads a csv with a header row. Recognized columns are
+// DeviceId, MacAddress, Owner and OwnNumber; other columns are ignored.
+func ParseExpectedDevices(r io.Reader) ([]ExpectedDevice, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty csv")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	_, hasId := columns["deviceid"]
+	_, hasMac := columns["macaddress"]
+	_, hasOwner := columns["owner"]
+	if !hasId && !hasMac && !hasOwner {
+		return nil, errors.New("csv needs one of DeviceId, MacAddress or Owner columns")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	expectedDevices := []ExpectedDevice{}
+	for line, record := range records[1:] {
+		expected := ExpectedDevice{
+			DeviceId:   field(record, "deviceid"),
+			MacAddress: field(record, "macaddress"),
+			Owner:      field(record, "owner"),
+		}
+		if ownNumber := field(record, "ownnumber"); ownNumber != "" {
+			if expected.OwnNumber, err = strconv.Atoi(ownNumber); err != nil {
+				return nil, fmt.Errorf("line %d: invalid OwnNumber %q", line+2, ownNumber)
+			}
+		}
+
+		if expected.DeviceId == "" && expected.MacAddress == "" && expected.Owner == "" {
+			continue
+		}
+		expectedDevices = append(expectedDevices, expected)
+	}
+
+	return expectedDevices, nil
+}
+
+// ReconcileDevices compares the expected devices with the registered ones.
+// Devices are matched by DeviceId, then MacAddress, then Owner and OwnNumber.
+func ReconcileDevices(expectedDevices []ExpectedDevice, devices []*DeviceInfo) ReconcileReport {
+	report := ReconcileReport{}
+	matched := map[string]bool{}
+
+	find := func(expected ExpectedDevice) *DeviceInfo {
+		for _, device := range devices {
+			if matched[device.DeviceId] {
+				continue
+			}
+			if expected.DeviceId != "" && expected.DeviceId == device.DeviceId {
+				return device
+			}
+		}
+		for _, device := range devices {
+			if matched[device.DeviceId] {
+				continue
+			}
+			if expected.MacAddress != "" && strings.EqualFold(expected.MacAddress, device.MacAddress) {
+				return device
+			}
+		}
+		for _, device := range devices {
+			if matched[device.DeviceId] {
+				continue
+			}
+			if expected.DeviceId == "" && expected.MacAddress == "" &&
+				expected.Owner == device.Owner && expected.OwnNumber == device.OwnNumber {
+				return device
+			}
+		}
+		return nil
+	}
+
+	for _, expected := range expectedDevices {
+		device := find(expected)
+		if device == nil {
+			report.Missing = append(report.Missing, expected)
+			continue
+		}
+
+		matched[device.DeviceId] = true
+		if (expected.Owner != "" && expected.Owner != device.Owner) ||
+			(expected.OwnNumber != 0 && expected.OwnNumber != device.OwnNumber) {
+			report.Mismatched = append(report.Mismatched, InventoryMismatch{Expected: expected, Device: *device})
+		} else {
+			report.Matched++
+		}
+	}
+
+	for _, device := range devices {
+		if !matched[device.DeviceId] {
+			report.Unexpected = append(report.Unexpected, *device)
+		}
+	}
+
+	return report
+}
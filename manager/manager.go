@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"poa-manager/auth"
 	"poa-manager/context"
 	"poa-manager/event"
 	"poa-manager/log"
@@ -19,7 +21,12 @@ import (
 
 var logger log.Logger = log.NewLogger("manager")
 
+var infoTopicRegexp = regexp.MustCompile("mine/[0-9]+\\.[0-9]+\\.[0-9]+\\.[0-9]+/.+/poa/info")
+var commandTopicRegexp = regexp.MustCompile("mine/[0-9]+\\.[0-9]+\\.[0-9]+\\.[0-9]+/.+/poa/command")
+
 type DeviceInfo struct {
+	SchemaVersion int `json:",omitempty"`
+
 	Timestamp int64
 
 	DeviceId   string
@@ -32,14 +39,20 @@ type DeviceInfo struct {
 	DeviceDesc string
 	Version    string
 
+	ConfigRevision int64
+
+	// device type specific values, see DeviceTypeInfo.DetailFields
+	Extra map[string]interface{} `json:",omitempty"`
+
 	Alive bool
 }
 
 type Manager struct {
-	Devices map[string]*DeviceInfo
-
-	TotalDevices []*DeviceInfo
-	DeadDevices  []*DeviceInfo
+	// replaced by the update loop, read with GetDevice, GetTotalDevices and GetDeadDevices
+	devices      map[string]*DeviceInfo
+	totalDevices []*DeviceInfo
+	deadDevices  []*DeviceInfo
+	mutexDevices *sync.RWMutex
 
 	serverAddress string
 	serverPort    int
@@ -52,10 +65,36 @@ type Manager struct {
 	mqttClientName string
 	mqttUser       string
 	mqttPassword   string
+	// the mqtt password is read again by Start, it may be unlocked after Init
+	configs *context.Configs
 
 	condChan chan int
 
 	nofityUpdatedChan chan int
+
+	retention retention
+
+	pendingInfos     map[string]*PendingInfo
+	mutexPendingInfo *sync.Mutex
+
+	remoteConfig remoteConfig
+
+	deviceLogs  deviceLogs
+	diagnostics diagnostics
+
+	identityTracker identityTracker
+
+	wakeRequests wakeRequests
+
+	recorder    mqttRecorder
+	monitor     mqttMonitor
+	replayPath  string
+	replaySpeed float64
+
+	rejectedMessages rejectedMessages
+
+	signer      commandSigner
+	payloadKeys payloadKeys
 }
 
 type DeadDevice struct {
@@ -99,40 +138,83 @@ type Restart struct {
 	Restart bool `json:"Restart,omitempty"`
 }
 
+// empty values are meaningful here, so the fields are always sent
+type Info struct {
+	Owner      string `json:"Owner"`
+	OwnNumber  int    `json:"OwnNumber"`
+	DeviceDesc string `json:"DeviceDesc"`
+}
+
 // server to client
 type Command struct {
-	Type string
-
-	Update  *Update  `json:"Update,omitempty"`
-	Mqtt    *Mqtt    `json:"Mqtt,omitempty"`
-	Restart *Restart `json:"Restart,omitempty"`
+	SchemaVersion int
+	Type          string
+
+	Update  *Update      `json:"Update,omitempty"`
+	Mqtt    *Mqtt        `json:"Mqtt,omitempty"`
+	Restart *Restart     `json:"Restart,omitempty"`
+	Info    *Info        `json:"Info,omitempty"`
+	Config  *Config      `json:"Config,omitempty"`
+	Log     *LogRequest  `json:"Log,omitempty"`
+	Diag    *DiagRequest `json:"Diag,omitempty"`
+	Wol     *Wol         `json:"Wol,omitempty"`
+
+	Key       *PayloadKey `json:"Key,omitempty"`
+	Signature *Signature  `json:"Signature,omitempty"`
 }
 
 func NewManager() *Manager {
-	return &Manager{Devices: make(map[string]*DeviceInfo)}
+	return &Manager{devices: make(map[string]*DeviceInfo), mutexDevices: &sync.RWMutex{}, pendingInfos: make(map[string]*PendingInfo), mutexPendingInfo: &sync.Mutex{},
+		remoteConfig:     remoteConfig{applied: make(map[string]int64), mutex: &sync.Mutex{}},
+		deviceLogs:       deviceLogs{logs: make(map[string]*DeviceLog), mutex: &sync.Mutex{}},
+		diagnostics:      diagnostics{runs: make(map[string]*DiagRun), mutex: &sync.Mutex{}},
+		identityTracker:  identityTracker{macs: make(map[string]string), mutex: &sync.Mutex{}},
+		wakeRequests:     wakeRequests{requests: make(map[string]*WakeRequest), mutex: &sync.Mutex{}},
+		recorder:         mqttRecorder{mutex: &sync.Mutex{}},
+		monitor:          mqttMonitor{mutex: &sync.Mutex{}},
+		rejectedMessages: rejectedMessages{devices: make(map[string]*RejectedMessages), mutex: &sync.Mutex{}}}
 }
 
 func (manager *Manager) mqttSubscribeHandler(client mqtt.Client, msg mqtt.Message) {
+	manager.recordMessage(msg)
+
+	msg, encrypted, err := manager.decryptMessage(msg)
+	manager.monitorMessage(msg, encrypted)
+	if err != nil {
+		manager.rejectMessage(msg.Topic(), msg.Payload(), err)
+		return
+	}
+
 	go func() {
-		logger.LogfV("Received message: %s from topic: %s\n", msg.Payload(), msg.Topic())
+		msgLogger := topicLogger(msg.Topic())
+		msgLogger.LogfV("Received message: %s", msg.Payload())
 
 		if match, _ := regexp.MatchString("mine/server/updated", msg.Topic()); match {
-			logger.LogD("rise mqtt updated message. start check status")
+			msgLogger.LogD("rise mqtt updated message. start check status")
 			manager.condChan <- 0
-		} else if match, _ := regexp.MatchString("mine/[0-9]+\\.[0-9]+\\.[0-9]+\\.[0-9]+/.+/poa/info", msg.Topic()); match {
-			logger.LogD("rise mqtt poa message. start check status")
+		} else if logReplyTopicRegexp.MatchString(msg.Topic()) {
+			manager.receiveLogChunk(msg.Topic(), msg.Payload())
+		} else if diagReplyTopicRegexp.MatchString(msg.Topic()) {
+			manager.receiveDiagResult(msg.Topic(), msg.Payload())
+		} else if infoTopicRegexp.MatchString(msg.Topic()) {
+			msgLogger.LogD("rise mqtt poa message. start check status")
 
-			deviceInfo, err := manager.parsePayload(string(msg.Payload()))
+			deviceInfo, err := manager.parsePayload(msg.Topic(), msg.Payload())
 
 			if err != nil {
-				logger.LogE(err)
+				manager.rejectMessage(msg.Topic(), msg.Payload(), err)
 				return
 			}
 
+			manager.confirmPendingInfo(&deviceInfo)
+			manager.updateAppliedConfig(&deviceInfo)
+			manager.trackIdentity(&deviceInfo)
+			manager.confirmWake(&deviceInfo)
+
 			var oldDeviceInfo DeviceInfo
 
-			if _, ok := manager.Devices[deviceInfo.DeviceId]; ok {
-				oldDeviceInfo = *manager.Devices[deviceInfo.DeviceId]
+			if oldDevice := manager.GetDevice(deviceInfo.DeviceId); oldDevice != nil {
+				oldDeviceInfo = *oldDevice
 			}
 
 			// Check changing the information displayed on the screen
@@ -150,16 +232,42 @@ func (manager *Manager) mqttSubscribeHandler(client mqtt.Client, msg mqtt.Messag
 	}()
 }
 
+// mqttLogger bridges the logs of the paho client, which start with the
+// component in brackets, e.g. "[client]   Connect()".
 type mqttLogger struct {
-	log.Logger
+	*log.Logger
+}
+
+var mqttComponentRegexp = regexp.MustCompile(`^\[(\w+)\]\s*`)
+
+func (l mqttLogger) output(text string) {
+	fieldLogger := l.Logger
+	if match := mqttComponentRegexp.FindStringSubmatch(text); match != nil {
+		fieldLogger = fieldLogger.With("component", match[1])
+		text = text[len(match[0]):]
+	}
+	fieldLogger.Log(l.Level, strings.TrimRight(text, "\n"))
 }
 
 func (l mqttLogger) Println(v ...interface{}) {
-	l.Log(l.Level, v...)
+	l.output(fmt.Sprintln(v...))
 }
 
 func (l mqttLogger) Printf(format string, v ...interface{}) {
-	l.LogFormat(l.Level, format, v...)
+	l.output(fmt.Sprintf(format, v...))
+}
+
+// topicLogger returns the logger with the topic and the device of an mqtt message.
+func topicLogger(topic string) *log.Logger {
+	if deviceId := TopicDeviceId(topic); deviceId != "" {
+		return logger.With("topic", topic, "device", deviceId)
+	}
+	return logger.With("topic", topic)
+}
+
+// commandLogger returns the logger with the device and the type of a command.
+func commandLogger(device *DeviceInfo, commandType string) *log.Logger {
+	return logger.With("device", device.DeviceId, "command", commandType)
 }
 
 func (manager *Manager) Init(poaContext *context.Context) {
@@ -174,11 +282,16 @@ func (manager *Manager) Init(poaContext *context.Context) {
 	manager.mqttClientName = fmt.Sprintf("poa-manager-%d", rand.Int31n(10000000))
 	manager.mqttUser = poaContext.Configs.MqttUser
 	manager.mqttPassword = poaContext.Configs.MqttPassword
+	manager.configs = &poaContext.Configs
 
-	mqtt.ERROR = mqttLogger{Logger: log.Logger{Tag: "mqtt", Timestamp: true, Level: log.Fatal}}
-	mqtt.CRITICAL = mqttLogger{Logger: log.Logger{Tag: "mqtt", Timestamp: true, Level: log.Error}}
-	mqtt.WARN = mqttLogger{Logger: log.Logger{Tag: "mqtt", Timestamp: true, Level: log.Warning}}
-	// mqtt.DEBUG = mqttLogger{Logger: log.Logger{Tag: "mqtt", Timestamp: true, Level: log.Debug}}
+	newMqttLogger := func(level log.Level) mqttLogger {
+		base := log.Logger{Tag: "mqtt", Timestamp: true, Level: level}
+		return mqttLogger{Logger: base.With("broker", fmt.Sprintf("%s:%d", manager.brokerAddress, manager.brokerPort), "client", manager.mqttClientName)}
+	}
+	mqtt.ERROR = newMqttLogger(log.Fatal)
+	mqtt.CRITICAL = newMqttLogger(log.Error)
+	mqtt.WARN = newMqttLogger(log.Warning)
+	// mqtt.DEBUG = newMqttLogger(log.Debug)
 
 	manager.mqttOpts = mqtt.NewClientOptions()
 	manager.mqttOpts.AddBroker(fmt.Sprintf("tcp://%s:%d", manager.brokerAddress, manager.brokerPort))
@@ -188,35 +301,52 @@ func (manager *Manager) Init(poaContext *context.Context) {
 	manager.mqttOpts.SetDefaultPublishHandler(manager.mqttSubscribeHandler)
 	manager.mqttOpts.SetAutoReconnect(true)
 	manager.mqttOpts.OnConnect = func(client mqtt.Client) {
-		logger.LogI("MQTT connected")
-		logger.LogD("Subscribe mine/#")
+		logger.With("broker", fmt.Sprintf("%s:%d", manager.brokerAddress, manager.brokerPort)).LogI("MQTT connected")
+		logger.With("topic", "mine/#").LogD("Subscribe mine/#")
 
 		token := manager.mqttClient.Subscribe("mine/#", manager.mqttQos, nil)
 		token.Wait()
 	}
 	manager.mqttOpts.OnConnectionLost = func(client mqtt.Client, err error) {
-		logger.LogfI("MQTT connect lost: %v", err)
+		logger.With("broker", fmt.Sprintf("%s:%d", manager.brokerAddress, manager.brokerPort)).LogfI("MQTT connect lost: %v", err)
 	}
 
 	manager.condChan = make(chan int, 100)
 	manager.nofityUpdatedChan = make(chan int)
 
+	manager.initRetention(poaContext)
+	manager.initCommandSigner(poaContext)
+	manager.initPayloadKeys(poaContext)
+
 	poaContext.EventLooper.RegisterEventHandler(event.MANAGER, manager.eventListener)
 }
 
 func (manager *Manager) Start() {
+	// the gui asks the config passphrase after Init
+	if manager.configs != nil && manager.configs.MqttPassword != manager.mqttPassword {
+		manager.mqttPassword = manager.configs.MqttPassword
+		manager.mqttOpts.SetPassword(manager.mqttPassword)
+	}
+
 	var mqttInit func()
 	mqttInit = func() {
 		manager.mqttClient = mqtt.NewClient(manager.mqttOpts)
 
 		if token := manager.mqttClient.Connect(); token.Wait() && token.Error() != nil {
-			logger.LogE(token.Error())
-			logger.LogI("retry after 60 seconds")
+			brokerLogger := logger.With("broker", fmt.Sprintf("%s:%d", manager.brokerAddress, manager.brokerPort))
+			brokerLogger.LogE(token.Error())
+			brokerLogger.LogI("retry after 60 seconds")
 			time.AfterFunc(time.Second*60, mqttInit)
 			return
 		}
 	}
-	go mqttInit()
+	if manager.replayPath != "" {
+		// commands published while replaying fail with not connected
+		manager.mqttClient = mqtt.NewClient(manager.mqttOpts)
+		go manager.replay()
+	} else {
+		go mqttInit()
+	}
 
 	go func() {
 		// run once at startup
@@ -228,15 +358,27 @@ func (manager *Manager) Start() {
 			<-manager.condChan
 
 			// get device status
-			manager.TotalDevices, manager.DeadDevices = manager.getTotalDevices()
+			totalDevices, deadDevices := manager.getTotalDevices()
+
+			manager.mutexDevices.Lock()
+			manager.totalDevices, manager.deadDevices = totalDevices, deadDevices
+			for _, device := range totalDevices {
+				manager.devices[device.DeviceId] = device
+			}
+			manager.mutexDevices.Unlock()
 
-			for _, device := range manager.TotalDevices {
-				manager.Devices[device.DeviceId] = device
+			for _, device := range totalDevices {
+				manager.trackIdentity(device)
+				if device.Alive {
+					manager.confirmWake(device)
+				}
 			}
 
 			manager.nofityUpdatedChan <- 0
 		}
 	}()
+
+	manager.startRetention()
 }
 
 func (manager *Manager) getDeviceStatus() (total int, dead int) {
@@ -258,6 +400,30 @@ func (manager *Manager) getDeviceStatus() (total int, dead int) {
 	return
 }
 
+// GetDevice returns the device of the last device list, nil if it is unknown or removed.
+func (manager *Manager) GetDevice(deviceId string) *DeviceInfo {
+	manager.mutexDevices.RLock()
+	defer manager.mutexDevices.RUnlock()
+
+	return manager.devices[deviceId]
+}
+
+// GetTotalDevices returns the last device list.
+func (manager *Manager) GetTotalDevices() []*DeviceInfo {
+	manager.mutexDevices.RLock()
+	defer manager.mutexDevices.RUnlock()
+
+	return manager.totalDevices
+}
+
+// GetDeadDevices returns the dead devices of the last device list.
+func (manager *Manager) GetDeadDevices() []*DeviceInfo {
+	manager.mutexDevices.RLock()
+	defer manager.mutexDevices.RUnlock()
+
+	return manager.deadDevices
+}
+
 func (manager *Manager) getTotalDevices() ([]*DeviceInfo, []*DeviceInfo) {
 	totalDevices := []*DeviceInfo{}
 	deadDevices := []*DeviceInfo{}
@@ -301,10 +467,26 @@ func (manager *Manager) getDeadDevices() []*DeviceInfo {
 }
 
 func (manager *Manager) RemoveDevices(id string) (bool, string) {
+	if err := auth.Check(auth.PermissionRemove); err != nil {
+		logger.With("device", id).LogE(err)
+		return false, ""
+	}
+
+	ok, removed := manager.removeDevice(id)
+	if ok {
+		// reload the device list, the pages are refreshed after the reload
+		manager.condChan <- 0
+	}
+
+	return ok, removed
+}
+
+func (manager *Manager) removeDevice(id string) (bool, string) {
 	var reqBody string
+	deviceLogger := logger.With("device", id)
 	req, err := http.NewRequest("DELETE", fmt.Sprintf("http://%s:%d/device/remove/%s", manager.serverAddress, manager.serverPort, id), strings.NewReader(reqBody))
 	if err != nil {
-		logger.LogE(err)
+		deviceLogger.LogE(err)
 
 		return false, ""
 	}
@@ -313,30 +495,29 @@ func (manager *Manager) RemoveDevices(id string) (bool, string) {
 	if err == nil {
 		bytes, _ := ioutil.ReadAll(resp.Body)
 		str := string(bytes)
-		logger.LogD(str)
+		deviceLogger.LogD(str)
 
 		response := Response{ /* Remove: &Remove{} */ }
 		json.Unmarshal(bytes, &response)
 
 		if len(response.Remove.List) > 0 {
+			// the reload of the device list does not drop the removed devices
+			manager.mutexDevices.Lock()
+			delete(manager.devices, id)
+			manager.mutexDevices.Unlock()
 			return true, response.Remove.List[0]
 		} else {
 			return false, ""
 		}
 	} else {
-		logger.LogE(err)
+		deviceLogger.LogE(err)
 	}
 
 	return false, ""
 }
 
-func (manager *Manager) parsePayload(payload string) (deviceInfo DeviceInfo, err error) {
-	err = json.Unmarshal([]byte(payload), &deviceInfo)
-	if err != nil {
-		logger.LogE(err)
-	}
-
-	return
+func (manager *Manager) parsePayload(topic string, payload []byte) (deviceInfo DeviceInfo, err error) {
+	return parseInfoPayload(topic, payload)
 }
 
 func (manager *Manager) WaitUpdated() {
@@ -344,91 +525,69 @@ func (manager *Manager) WaitUpdated() {
 }
 
 func (manager *Manager) eventListener(name event.EventName, args []interface{}) {
-	logger.LogD("name:", name, args)
+	eventLogger := logger.With("event", name)
+	if name == event.EVENT_MANAGER_DEVICE_MQTT_CHANGE_USER_PASSWORD && len(args) == 2 {
+		eventLogger.LogD("name:", name, []interface{}{args[0], context.RedactedSecret})
+	} else {
+		eventLogger.LogD("name:", name, args)
+	}
+
+	// every manager event sends commands to the devices
+	if err := auth.Check(auth.PermissionCommand); err != nil {
+		eventLogger.LogE(err)
+		return
+	}
 
 	switch name {
 	case event.EVENT_MANAGER_DEVICE_RESTART:
-		command := Command{Type: "restart", Restart: &Restart{}}
+		command := Command{Type: CommandRestart, Restart: &Restart{}}
 		command.Restart.Restart = true
 
-		doc, err := json.MarshalIndent(command, "", "    ")
-		if err == nil {
-			for _, device := range manager.TotalDevices {
-				if device.Alive {
-					cmdAddress := fmt.Sprintf("mine/%s/%s/poa/command", device.PublicIp, device.DeviceId)
-
-					logger.LogD("cmdAddress:", cmdAddress, " <- ", string(doc))
-
-					token := manager.mqttClient.Publish(cmdAddress, manager.mqttQos, false, string(doc))
-					token.Wait()
-				}
-			}
-		} else {
-			logger.LogE(err)
-		}
+		manager.publishCommandAll(command)
 
 	case event.EVENT_MANAGER_DEVICE_MQTT_CHANGE_USER_PASSWORD:
 		if len(args) == 2 {
-			command := Command{Type: "mqtt", Mqtt: &Mqtt{}}
+			command := Command{Type: CommandMqtt, Mqtt: &Mqtt{}}
 			command.Mqtt.MqttUser = args[0].(string)
 			command.Mqtt.MqttPassword = args[1].(string)
 
-			doc, err := json.MarshalIndent(command, "", "    ")
-			if err == nil {
-				for _, device := range manager.TotalDevices {
-					if device.Alive {
-						cmdAddress := fmt.Sprintf("mine/%s/%s/poa/command", device.PublicIp, device.DeviceId)
-
-						logger.LogD("cmdAddress:", cmdAddress, " <- ", string(doc))
-
-						token := manager.mqttClient.Publish(cmdAddress, manager.mqttQos, false, string(doc))
-						token.Wait()
-					}
-				}
-			} else {
-				logger.LogE(err)
-			}
+			manager.publishCommandAll(command)
 		}
 	case event.EVENT_MANAGER_DEVICE_FORCE_UPDATE:
-		command := Command{Type: "update", Update: &Update{}}
+		command := Command{Type: CommandUpdate, Update: &Update{}}
 		command.Update.ForceUpdate = true
 
-		doc, err := json.MarshalIndent(command, "", "    ")
-		if err == nil {
-			for _, device := range manager.TotalDevices {
-				if device.Alive {
-					cmdAddress := fmt.Sprintf("mine/%s/%s/poa/command", device.PublicIp, device.DeviceId)
+		manager.publishCommandAll(command)
+
+	case event.EVENT_MANAGER_DEVICE_CHANGE_INFO:
+		if len(args) == 4 {
+			manager.requestInfoChange(args[0].(string), Info{Owner: args[1].(string), OwnNumber: args[2].(int), DeviceDesc: args[3].(string)})
+		}
+
+	case event.EVENT_MANAGER_DEVICE_PUSH_CONFIG:
+		if len(args) == 2 {
+			manager.pushConfig(args[0].(map[string]interface{}), args[1].([]string))
+		}
 
-					logger.LogD("cmdAddress:", cmdAddress, " <- ", string(doc))
+	case event.EVENT_MANAGER_DEVICE_FORCE_UPDATE_DEVICES:
+		if len(args) == 1 {
+			command := Command{Type: CommandUpdate, Update: &Update{ForceUpdate: true}}
 
-					token := manager.mqttClient.Publish(cmdAddress, manager.mqttQos, false, string(doc))
-					token.Wait()
+			for _, deviceId := range args[0].([]string) {
+				if device := manager.GetDevice(deviceId); device != nil && device.Alive {
+					if err := manager.publishCommand(device, command); err != nil {
+						commandLogger(device, command.Type).LogE(err)
+					}
 				}
 			}
-		} else {
-			logger.LogE(err)
 		}
 
 	case event.EVENT_MANAGER_DEVICE_CHANGE_UPDATE_ADDRESS:
 		if len(args) == 1 {
-			command := Command{Type: "update", Update: &Update{}}
+			command := Command{Type: CommandUpdate, Update: &Update{}}
 			command.Update.UpdateAddress = args[0].(string)
 
-			doc, err := json.MarshalIndent(command, "", "    ")
-			if err == nil {
-				for _, device := range manager.TotalDevices {
-					if device.Alive {
-						cmdAddress := fmt.Sprintf("mine/%s/%s/poa/command", device.PublicIp, device.DeviceId)
-
-						logger.LogD("cmdAddress:", cmdAddress, " <- ", string(doc))
-
-						token := manager.mqttClient.Publish(cmdAddress, manager.mqttQos, false, string(doc))
-						token.Wait()
-					}
-				}
-			} else {
-				logger.LogE(err)
-			}
+			manager.publishCommandAll(command)
 		}
 	}
 }
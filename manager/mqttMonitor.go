@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const mqttMonitorMaxRecords = 1000
+
+// recent received messages shown by the mqtt inspector
+type mqttMonitor struct {
+	records []MqttRecord
+	mutex   *sync.Mutex
+}
+
+func (manager *Manager) monitorMessage(msg mqtt.Message, encrypted bool) {
+	monitor := &manager.monitor
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	record := newMqttRecord(msg)
+	record.Encrypted = encrypted
+	// the commands of the manager come back on mine/#, the inspector is open to
+	// every role so the passwords and the keys they carry are not kept
+	if commandTopicRegexp.MatchString(msg.Topic()) {
+		if command, err := UnwrapCommand(msg.Payload()); err == nil {
+			record.Payload = redactCommand(command)
+			record.PayloadBase64 = ""
+		} else if encrypted {
+			record.Payload = ""
+			record.PayloadBase64 = ""
+		}
+	}
+	// timestamps identify the records, keep them increasing
+	if n := len(monitor.records); n > 0 && record.Timestamp <= monitor.records[n-1].Timestamp {
+		record.Timestamp = monitor.records[n-1].Timestamp + 1
+	}
+
+	monitor.records = append(monitor.records, record)
+	if len(monitor.records) > mqttMonitorMaxRecords {
+		monitor.records = monitor.records[len(monitor.records)-mqttMonitorMaxRecords:]
+	}
+}
+
+// GetMqttMessages returns the recent received messages newer than the timestamp.
+func (manager *Manager) GetMqttMessages(after int64) []MqttRecord {
+	monitor := &manager.monitor
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	records := []MqttRecord{}
+	for _, record := range monitor.records {
+		if record.Timestamp > after {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
+
+// PublishRawCommand sends a hand written command payload to the device.
+func (manager *Manager) PublishRawCommand(deviceId string, payload string) error {
+	device := manager.GetDevice(deviceId)
+	if device == nil {
+		return fmt.Errorf("unknown device: %s", deviceId)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(payload)))
+	decoder.DisallowUnknownFields()
+
+	command := Command{}
+	if err := decoder.Decode(&command); err != nil {
+		return err
+	}
+	if command.Type == "" {
+		return fmt.Errorf("command type is empty")
+	}
+
+	return manager.publishCommand(device, command)
+}
@@ -0,0 +1,215 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// one received mqtt message, stored as a json line in the recording file
+type MqttRecord struct {
+	Timestamp int64 // unix nano
+	Topic     string
+	Qos       byte
+	Retained  bool
+
+	// the payload was decrypted, only set by the monitor
+	Encrypted bool `json:",omitempty"`
+
+	// text payloads are stored as is, others in base64
+	Payload       string `json:"Payload,omitempty"`
+	PayloadBase64 string `json:"PayloadBase64,omitempty"`
+}
+
+type mqttRecorder struct {
+	file    *os.File
+	writer  *bufio.Writer
+	path    string
+	records int
+	mutex   *sync.Mutex
+}
+
+// recordedMessage implements mqtt.Message for replaying a record
+type recordedMessage struct {
+	record  MqttRecord
+	payload []byte
+}
+
+func (msg *recordedMessage) Duplicate() bool   { return false }
+func (msg *recordedMessage) Qos() byte         { return msg.record.Qos }
+func (msg *recordedMessage) Retained() bool    { return msg.record.Retained }
+func (msg *recordedMessage) Topic() string     { return msg.record.Topic }
+func (msg *recordedMessage) MessageID() uint16 { return 0 }
+func (msg *recordedMessage) Payload() []byte   { return msg.payload }
+func (msg *recordedMessage) Ack()              {}
+
+func newMqttRecord(msg mqtt.Message) MqttRecord {
+	record := MqttRecord{
+		Timestamp: time.Now().UnixNano(),
+		Topic:     msg.Topic(),
+		Qos:       msg.Qos(),
+		Retained:  msg.Retained(),
+	}
+	if utf8.Valid(msg.Payload()) {
+		record.Payload = string(msg.Payload())
+	} else {
+		record.PayloadBase64 = base64.StdEncoding.EncodeToString(msg.Payload())
+	}
+
+	return record
+}
+
+func (record *MqttRecord) message() (mqtt.Message, error) {
+	payload := []byte(record.Payload)
+	if record.PayloadBase64 != "" {
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(record.PayloadBase64); err != nil {
+			return nil, err
+		}
+	}
+
+	return &recordedMessage{record: *record, payload: payload}, nil
+}
+
+// StartRecording appends every received mqtt message to the file.
+func (manager *Manager) StartRecording(path string) error {
+	recorder := &manager.recorder
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recorder.file != nil {
+		return errors.New("already recording to " + recorder.path)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	recorder.file = file
+	recorder.writer = bufio.NewWriter(file)
+	recorder.path = path
+	recorder.records = 0
+
+	logger.LogfI("start recording mqtt messages to %s", path)
+
+	return nil
+}
+
+// StopRecording closes the recording file and returns the number of recorded messages.
+func (manager *Manager) StopRecording() int {
+	recorder := &manager.recorder
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recorder.file == nil {
+		return 0
+	}
+
+	if err := recorder.writer.Flush(); err != nil {
+		logger.LogE(err)
+	}
+	if err := recorder.file.Close(); err != nil {
+		logger.LogE(err)
+	}
+	recorder.file = nil
+	recorder.writer = nil
+
+	logger.LogfI("stop recording mqtt messages, %d messages in %s", recorder.records, recorder.path)
+
+	return recorder.records
+}
+
+// Recording returns the path of the recording file, empty if not recording.
+func (manager *Manager) Recording() (path string, records int) {
+	recorder := &manager.recorder
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recorder.file == nil {
+		return "", 0
+	}
+
+	return recorder.path, recorder.records
+}
+
+func (manager *Manager) recordMessage(msg mqtt.Message) {
+	recorder := &manager.recorder
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recorder.file == nil {
+		return
+	}
+
+	doc, err := json.Marshal(newMqttRecord(msg))
+	if err != nil {
+		topicLogger(msg.Topic()).LogE(err)
+		return
+	}
+
+	recorder.writer.Write(doc)
+	recorder.writer.WriteByte('\n')
+	// flush each message, the recording should survive a crash
+	if err := recorder.writer.Flush(); err != nil {
+		logger.LogE(err)
+	}
+	recorder.records++
+}
+
+// SetReplay makes Start feed the recording into the manager instead of
+// connecting to the mqtt broker. speed 1 replays in real time, 0 as fast as possible.
+func (manager *Manager) SetReplay(path string, speed float64) {
+	manager.replayPath = path
+	manager.replaySpeed = speed
+}
+
+func (manager *Manager) replay() {
+	file, err := os.Open(manager.replayPath)
+	if err != nil {
+		logger.LogE(err)
+		return
+	}
+	defer file.Close()
+
+	logger.LogfI("replay mqtt messages from %s, speed %v", manager.replayPath, manager.replaySpeed)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var lastTimestamp int64
+	count := 0
+	for scanner.Scan() {
+		record := MqttRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logger.LogE(err)
+			continue
+		}
+
+		if lastTimestamp != 0 && manager.replaySpeed > 0 && record.Timestamp > lastTimestamp {
+			time.Sleep(time.Duration(float64(record.Timestamp-lastTimestamp) / manager.replaySpeed))
+		}
+		lastTimestamp = record.Timestamp
+
+		msg, err := record.message()
+		if err != nil {
+			topicLogger(record.Topic).LogE(err)
+			continue
+		}
+
+		manager.mqttSubscribeHandler(manager.mqttClient, msg)
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		logger.LogE(err)
+	}
+
+	logger.LogfI("replay finished, %d messages", count)
+}
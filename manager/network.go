@@ -0,0 +1,16 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+)
+
+// PrivateSubnet returns the subnet of the ip in CIDR notation, or "" if the ip is not valid.
+func PrivateSubnet(privateIp string, prefixLength int) string {
+	ip := net.ParseIP(privateIp).To4()
+	if ip == nil || prefixLength <= 0 || prefixLength > 32 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/%d", ip.Mask(net.CIDRMask(prefixLength, 32)).String(), prefixLength)
+}
@@ -0,0 +1,447 @@
+package manager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"poa-manager/auth"
+	"poa-manager/context"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// aes-256 key for the payloads of the fleet or of a single device
+type PayloadKey struct {
+	KeyId string
+	Key   []byte
+}
+
+// payload published instead of the plain json when encryption is used.
+// the topic is the additional data, so a payload is not valid on other topics.
+type EncryptedPayload struct {
+	KeyId string
+	Nonce []byte
+	Data  []byte
+}
+
+type encryptedEnvelope struct {
+	Encrypted *EncryptedPayload `json:"Encrypted,omitempty"`
+}
+
+// stored in the payload key file
+type payloadKeyFile struct {
+	FleetKey *PayloadKey
+	// the previous fleet keys
+	PreviousKeys []*PayloadKey          `json:",omitempty"`
+	DeviceKeys   map[string]*PayloadKey `json:",omitempty"`
+	// the previous keys of each device, a device only accepts its own keys
+	PreviousDeviceKeys map[string][]*PayloadKey `json:",omitempty"`
+
+	// devices which have sent an encrypted poa/info, and the key id of the last one.
+	// Plain payloads of these devices are rejected and their commands are never sent in plain.
+	EncryptedDevices map[string]string `json:",omitempty"`
+}
+
+const maxPreviousPayloadKeys = 5
+
+type payloadKeys struct {
+	path  string
+	keys  payloadKeyFile
+	mutex *sync.Mutex
+}
+
+type decryptedMessage struct {
+	mqtt.Message
+	payload []byte
+}
+
+func (msg *decryptedMessage) Payload() []byte { return msg.payload }
+
+func NewPayloadKey() (*PayloadKey, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(key)
+	return &PayloadKey{KeyId: hex.EncodeToString(sum[:8]), Key: key}, nil
+}
+
+// EncryptPayload encrypts the payload for the topic with AES-GCM.
+func EncryptPayload(key *PayloadKey, topic string, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key.Key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(encryptedEnvelope{Encrypted: &EncryptedPayload{
+		KeyId: key.KeyId,
+		Nonce: nonce,
+		Data:  gcm.Seal(nil, nonce, payload, []byte(topic)),
+	}})
+}
+
+// DecryptPayload returns the plain payload. Payloads which are not encrypted
+// are returned as is with an empty key id.
+func DecryptPayload(keys []*PayloadKey, topic string, payload []byte) (plain []byte, keyId string, err error) {
+	envelope := encryptedEnvelope{}
+	if json.Unmarshal(payload, &envelope) != nil || envelope.Encrypted == nil {
+		return payload, "", nil
+	}
+
+	encrypted := envelope.Encrypted
+	for _, key := range keys {
+		if key == nil || key.KeyId != encrypted.KeyId {
+			continue
+		}
+
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, key.KeyId, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, key.KeyId, err
+		}
+		if len(encrypted.Nonce) != gcm.NonceSize() {
+			return nil, key.KeyId, errors.New("invalid nonce")
+		}
+
+		plain, err = gcm.Open(nil, encrypted.Nonce, encrypted.Data, []byte(topic))
+		return plain, key.KeyId, err
+	}
+
+	return nil, encrypted.KeyId, fmt.Errorf("unknown payload key: %s", encrypted.KeyId)
+}
+
+func (manager *Manager) initPayloadKeys(poaContext *context.Context) {
+	manager.payloadKeys = payloadKeys{
+		path:  poaContext.ResolvePath(poaContext.Configs.PayloadKeyPath),
+		mutex: &sync.Mutex{},
+	}
+
+	if err := manager.payloadKeys.load(); err != nil {
+		logger.LogE(err)
+	}
+}
+
+// load reads the key file, creating a fleet key if the file does not exist.
+func (payloadKeys *payloadKeys) load() error {
+	payloadKeys.mutex.Lock()
+	defer payloadKeys.mutex.Unlock()
+
+	doc, err := os.ReadFile(payloadKeys.path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.LogfI("create payload key: %s", payloadKeys.path)
+		if payloadKeys.keys.FleetKey, err = NewPayloadKey(); err != nil {
+			return err
+		}
+		return payloadKeys.save()
+	} else if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(doc, &payloadKeys.keys); err != nil {
+		return err
+	}
+	if payloadKeys.keys.EncryptedDevices == nil {
+		payloadKeys.keys.EncryptedDevices = map[string]string{}
+	}
+
+	return nil
+}
+
+func (payloadKeys *payloadKeys) save() error {
+	if payloadKeys.keys.EncryptedDevices == nil {
+		payloadKeys.keys.EncryptedDevices = map[string]string{}
+	}
+
+	return payloadKeys.write(payloadKeys.keys)
+}
+
+func (payloadKeys *payloadKeys) write(keys payloadKeyFile) error {
+	doc, err := json.MarshalIndent(keys, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(payloadKeys.path, doc, 0600)
+}
+
+// clone copies the keys which are changed by a rotation.
+func (keys payloadKeyFile) clone() payloadKeyFile {
+	keys.PreviousKeys = append([]*PayloadKey{}, keys.PreviousKeys...)
+
+	deviceKeys := map[string]*PayloadKey{}
+	for deviceId, key := range keys.DeviceKeys {
+		deviceKeys[deviceId] = key
+	}
+	keys.DeviceKeys = deviceKeys
+
+	previousDeviceKeys := map[string][]*PayloadKey{}
+	for deviceId, previous := range keys.PreviousDeviceKeys {
+		previousDeviceKeys[deviceId] = append([]*PayloadKey{}, previous...)
+	}
+	keys.PreviousDeviceKeys = previousDeviceKeys
+
+	return keys
+}
+
+// decryptionKeys returns the keys a device may use, the current one first.
+// A device with its own key does not accept the fleet key, which other devices know.
+func (payloadKeys *payloadKeys) decryptionKeys(deviceId string) []*PayloadKey {
+	if key := payloadKeys.keys.DeviceKeys[deviceId]; key != nil {
+		return append([]*PayloadKey{key}, payloadKeys.keys.PreviousDeviceKeys[deviceId]...)
+	}
+
+	return append([]*PayloadKey{payloadKeys.keys.FleetKey}, payloadKeys.keys.PreviousKeys...)
+}
+
+// keyById returns the key of the device with the id, nil if it is unknown or pruned.
+func (payloadKeys *payloadKeys) keyById(deviceId string, keyId string) *PayloadKey {
+	for _, key := range payloadKeys.decryptionKeys(deviceId) {
+		if key != nil && key.KeyId == keyId {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// usesEncryption reports if the payloads of the device must be encrypted.
+func (payloadKeys *payloadKeys) usesEncryption(deviceId string) bool {
+	_, encrypted := payloadKeys.keys.EncryptedDevices[deviceId]
+	return encrypted || payloadKeys.keys.DeviceKeys[deviceId] != nil
+}
+
+// decryptMessage replaces an encrypted payload by the plain one and remembers
+// which devices use encryption.
+func (manager *Manager) decryptMessage(msg mqtt.Message) (mqtt.Message, bool, error) {
+	deviceId := TopicDeviceId(msg.Topic())
+
+	payloadKeys := &manager.payloadKeys
+	payloadKeys.mutex.Lock()
+	defer payloadKeys.mutex.Unlock()
+
+	plain, keyId, err := DecryptPayload(payloadKeys.decryptionKeys(deviceId), msg.Topic(), msg.Payload())
+	if err != nil {
+		return msg, keyId != "", err
+	}
+
+	if keyId == "" {
+		// the commands of the manager on mine/# are not payloads of the device
+		if deviceId != "" && !commandTopicRegexp.MatchString(msg.Topic()) && payloadKeys.usesEncryption(deviceId) {
+			return msg, false, errors.New("plain payload from a device using encryption")
+		}
+		return msg, false, nil
+	}
+
+	if infoTopicRegexp.MatchString(msg.Topic()) && payloadKeys.keys.EncryptedDevices[deviceId] != keyId {
+		payloadKeys.keys.EncryptedDevices[deviceId] = keyId
+		if err := payloadKeys.save(); err != nil {
+			topicLogger(msg.Topic()).LogE(err)
+		}
+	}
+
+	return &decryptedMessage{Message: msg, payload: plain}, true, nil
+}
+
+// commandKey returns the key of the last poa/info of the device, so devices which
+// missed a new key still read their commands. It is nil for the devices not using encryption.
+func (payloadKeys *payloadKeys) commandKey(deviceId string) (*PayloadKey, error) {
+	if !payloadKeys.usesEncryption(deviceId) {
+		return nil, nil
+	}
+
+	var key *PayloadKey
+	if keyId, ok := payloadKeys.keys.EncryptedDevices[deviceId]; ok {
+		key = payloadKeys.keyById(deviceId, keyId)
+	}
+	if key == nil {
+		// provisioned with its own key, no poa/info with it yet
+		key = payloadKeys.keys.DeviceKeys[deviceId]
+	}
+	if key == nil {
+		return nil, fmt.Errorf("no payload key for %s, the command is not sent in plain", deviceId)
+	}
+
+	return key, nil
+}
+
+// encryptCommand encrypts the command payload for the devices using encryption,
+// with the given key or the key of their last poa/info if it is nil.
+func (manager *Manager) encryptCommand(device *DeviceInfo, topic string, payload []byte, key *PayloadKey) ([]byte, error) {
+	if key == nil {
+		payloadKeys := &manager.payloadKeys
+		payloadKeys.mutex.Lock()
+		var err error
+		key, err = payloadKeys.commandKey(device.DeviceId)
+		payloadKeys.mutex.Unlock()
+
+		if err != nil {
+			return nil, err
+		} else if key == nil {
+			return payload, nil
+		}
+	}
+
+	return EncryptPayload(key, topic, payload)
+}
+
+// EncryptionKeyId returns the key id of the last encrypted poa/info of the
+// device, empty if the device has not sent one.
+func (manager *Manager) EncryptionKeyId(deviceId string) string {
+	manager.payloadKeys.mutex.Lock()
+	defer manager.payloadKeys.mutex.Unlock()
+
+	return manager.payloadKeys.keys.EncryptedDevices[deviceId]
+}
+
+// ExportPayloadKey returns the key of the device, or the fleet key if the
+// device id is empty, as json for provisioning the agents.
+func (manager *Manager) ExportPayloadKey(deviceId string) ([]byte, error) {
+	if err := auth.Check(auth.PermissionKeys); err != nil {
+		return nil, err
+	}
+
+	manager.payloadKeys.mutex.Lock()
+	defer manager.payloadKeys.mutex.Unlock()
+
+	key := manager.payloadKeys.keys.FleetKey
+	if deviceId != "" {
+		key = manager.payloadKeys.keys.DeviceKeys[deviceId]
+	}
+	if key == nil {
+		return nil, errors.New("no payload key")
+	}
+
+	return json.MarshalIndent(key, "", "    ")
+}
+
+// FleetKeyId returns the id of the current fleet key.
+func (manager *Manager) FleetKeyId() string {
+	manager.payloadKeys.mutex.Lock()
+	defer manager.payloadKeys.mutex.Unlock()
+
+	if manager.payloadKeys.keys.FleetKey == nil {
+		return ""
+	}
+
+	return manager.payloadKeys.keys.FleetKey.KeyId
+}
+
+// DeviceKeyId returns the id of the device specific key, empty if the device uses the fleet key.
+func (manager *Manager) DeviceKeyId(deviceId string) string {
+	manager.payloadKeys.mutex.Lock()
+	defer manager.payloadKeys.mutex.Unlock()
+
+	if key := manager.payloadKeys.keys.DeviceKeys[deviceId]; key != nil {
+		return key.KeyId
+	}
+
+	return ""
+}
+
+// DistributePayloadKey sends a new key to the device through the key command,
+// encrypted with the key the device uses now. Devices not using encryption yet
+// have to be provisioned with an exported key file.
+// The fleet key is replaced if the device id is empty.
+func (manager *Manager) DistributePayloadKey(deviceId string) error {
+	if err := auth.Check(auth.PermissionKeys); err != nil {
+		return err
+	}
+
+	key, err := NewPayloadKey()
+	if err != nil {
+		return err
+	}
+
+	devices := []*DeviceInfo{}
+	if deviceId == "" {
+		for _, device := range manager.GetTotalDevices() {
+			if manager.EncryptionKeyId(device.DeviceId) != "" && manager.DeviceKeyId(device.DeviceId) == "" {
+				devices = append(devices, device)
+			}
+		}
+	} else if device := manager.GetDevice(deviceId); device != nil {
+		if manager.EncryptionKeyId(deviceId) == "" {
+			return fmt.Errorf("device does not use encryption: %s", deviceId)
+		}
+		devices = append(devices, device)
+	} else {
+		return fmt.Errorf("unknown device: %s", deviceId)
+	}
+
+	// the key command is encrypted with the key the device uses now, the new key is
+	// stored before it is sent so the devices are never switched to an unknown key
+	payloadKeys := &manager.payloadKeys
+	payloadKeys.mutex.Lock()
+	currentKeys := map[string]*PayloadKey{}
+	for _, device := range devices {
+		if currentKeys[device.DeviceId], err = payloadKeys.commandKey(device.DeviceId); err != nil {
+			commandLogger(device, CommandKey).LogE(err)
+		}
+	}
+
+	keys := payloadKeys.keys.clone()
+	if deviceId == "" {
+		// devices which missed the new key keep working with the previous one
+		if keys.FleetKey != nil {
+			keys.PreviousKeys = append(keys.PreviousKeys, keys.FleetKey)
+		}
+		keys.FleetKey = key
+		if n := len(keys.PreviousKeys); n > maxPreviousPayloadKeys {
+			keys.PreviousKeys = keys.PreviousKeys[n-maxPreviousPayloadKeys:]
+		}
+	} else {
+		if old := keys.DeviceKeys[deviceId]; old != nil {
+			previous := append(keys.PreviousDeviceKeys[deviceId], old)
+			if n := len(previous); n > maxPreviousPayloadKeys {
+				previous = previous[n-maxPreviousPayloadKeys:]
+			}
+			keys.PreviousDeviceKeys[deviceId] = previous
+		}
+		keys.DeviceKeys[deviceId] = key
+	}
+
+	err = payloadKeys.write(keys)
+	if err == nil {
+		payloadKeys.keys = keys
+	}
+	payloadKeys.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		if !device.Alive {
+			commandLogger(device, CommandKey).LogfW("payload key not sent to dead device: %s", device.DeviceId)
+			continue
+		}
+		if currentKeys[device.DeviceId] == nil {
+			continue
+		}
+		if err := manager.publishCommandKey(device, Command{Type: CommandKey, Key: key}, currentKeys[device.DeviceId]); err != nil {
+			commandLogger(device, CommandKey).LogE(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schema versions of the payloads. agents before versioning send no version
+// and are handled as version 1.
+const (
+	InfoSchemaVersion    = 2
+	CommandSchemaVersion = 2
+)
+
+const (
+	// timestamps before this are clock errors of the device
+	minValidTimestamp     = 1577836800 // 2020-01-01
+	maxTimestampSkewSec   = 300
+	millisecondsThreshold = 100000000000
+	maxRejectedPayloadLen = 2048
+)
+
+// malformed poa/info messages received from a device
+type RejectedMessages struct {
+	DeviceId string
+	Count    int
+
+	LastTopic   string
+	LastError   string
+	LastPayload string
+	LastTime    int64
+}
+
+type rejectedMessages struct {
+	devices map[string]*RejectedMessages
+	mutex   *sync.Mutex
+}
+
+// upgradeInfo converts a payload of an older agent to the current schema.
+func upgradeInfo(deviceInfo *DeviceInfo) {
+	if deviceInfo.SchemaVersion == 0 {
+		deviceInfo.SchemaVersion = 1
+	}
+
+	if deviceInfo.SchemaVersion == 1 {
+		// version 1 agents on windows reported milliseconds and dash separated mac addresses
+		if deviceInfo.Timestamp > millisecondsThreshold {
+			deviceInfo.Timestamp /= 1000
+		}
+		deviceInfo.MacAddress = strings.ReplaceAll(deviceInfo.MacAddress, "-", ":")
+		deviceInfo.SchemaVersion = 2
+	}
+}
+
+func validateIPv4(name string, value string) error {
+	if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+		return fmt.Errorf("invalid %s: %q", name, value)
+	}
+
+	return nil
+}
+
+// ValidateInfo checks the required fields and formats of the device info.
+func ValidateInfo(deviceInfo *DeviceInfo) error {
+	if deviceInfo.SchemaVersion > InfoSchemaVersion {
+		return fmt.Errorf("unsupported schema version: %d", deviceInfo.SchemaVersion)
+	}
+	if strings.TrimSpace(deviceInfo.DeviceId) == "" {
+		return fmt.Errorf("DeviceId is empty")
+	}
+	if _, err := net.ParseMAC(deviceInfo.MacAddress); err != nil {
+		return fmt.Errorf("invalid MacAddress: %q", deviceInfo.MacAddress)
+	}
+	if err := validateIPv4("PublicIp", deviceInfo.PublicIp); err != nil {
+		return err
+	}
+	if err := validateIPv4("PrivateIp", deviceInfo.PrivateIp); err != nil {
+		return err
+	}
+	if deviceInfo.Timestamp < minValidTimestamp || deviceInfo.Timestamp > time.Now().Unix()+maxTimestampSkewSec {
+		return fmt.Errorf("invalid Timestamp: %d", deviceInfo.Timestamp)
+	}
+	if deviceInfo.OwnNumber < 0 {
+		return fmt.Errorf("invalid OwnNumber: %d", deviceInfo.OwnNumber)
+	}
+
+	return nil
+}
+
+// parseInfoPayload decodes, upgrades and validates a poa/info payload
+// published on the topic of the device.
+func parseInfoPayload(topic string, payload []byte) (deviceInfo DeviceInfo, err error) {
+	if err = json.Unmarshal(payload, &deviceInfo); err != nil {
+		return
+	}
+
+	upgradeInfo(&deviceInfo)
+
+	if err = ValidateInfo(&deviceInfo); err != nil {
+		return
+	}
+
+	if topicDeviceId := TopicDeviceId(topic); topicDeviceId != "" && topicDeviceId != deviceInfo.DeviceId {
+		err = fmt.Errorf("DeviceId %q does not match the topic", deviceInfo.DeviceId)
+	}
+
+	return
+}
+
+// TopicDeviceId returns the device id of a mine/<publicIp>/<deviceId>/poa/... topic.
+func TopicDeviceId(topic string) string {
+	split := strings.Split(topic, "/")
+	if len(split) < 4 || split[0] != "mine" || split[3] != "poa" {
+		return ""
+	}
+
+	return split[2]
+}
+
+func (manager *Manager) rejectMessage(topic string, payload []byte, err error) {
+	deviceId := TopicDeviceId(topic)
+	topicLogger(topic).LogfW("rejected message from %s: %v", topic, err)
+
+	rejected := &manager.rejectedMessages
+	rejected.mutex.Lock()
+	defer rejected.mutex.Unlock()
+
+	device, ok := rejected.devices[deviceId]
+	if !ok {
+		device = &RejectedMessages{DeviceId: deviceId}
+		rejected.devices[deviceId] = device
+	}
+
+	device.Count++
+	device.LastTopic = topic
+	device.LastError = err.Error()
+	device.LastTime = time.Now().Unix()
+	device.LastPayload = string(payload)
+	if len(device.LastPayload) > maxRejectedPayloadLen {
+		device.LastPayload = device.LastPayload[:maxRejectedPayloadLen] + "..."
+	}
+}
+
+// GetRejectedMessages returns the rejected message counters ordered by device id.
+func (manager *Manager) GetRejectedMessages() []RejectedMessages {
+	rejected := &manager.rejectedMessages
+	rejected.mutex.Lock()
+	defer rejected.mutex.Unlock()
+
+	list := []RejectedMessages{}
+	for _, device := range rejected.devices {
+		list = append(list, *device)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].DeviceId < list[j].DeviceId
+	})
+
+	return list
+}
+
+func (manager *Manager) ResetRejectedMessages(deviceId string) {
+	rejected := &manager.rejectedMessages
+	rejected.mutex.Lock()
+	defer rejected.mutex.Unlock()
+
+	delete(rejected.devices, deviceId)
+}
@@ -0,0 +1,202 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ConfigValueType int
+
+const (
+	ConfigTypeBool ConfigValueType = iota
+	ConfigTypeInt
+	ConfigTypeString
+	ConfigTypeEnum
+)
+
+// ConfigKey describes an agent setting which can be pushed with the config command.
+type ConfigKey struct {
+	Name        string
+	Type        ConfigValueType
+	Description string
+
+	Min     int
+	Max     int
+	Options []string
+}
+
+// known agent settings, the form in the device control page is generated from this
+var ConfigSchema = []ConfigKey{
+	{Name: "ReportIntervalSec", Type: ConfigTypeInt, Description: "상태 보고 주기(초)", Min: 10, Max: 3600},
+	{Name: "LogLevel", Type: ConfigTypeEnum, Description: "로그 레벨", Options: []string{"verbose", "debug", "info", "warning", "error"}},
+	{Name: "UpdateCheckIntervalSec", Type: ConfigTypeInt, Description: "업데이트 확인 주기(초)", Min: 60, Max: 86400},
+	{Name: "AutoUpdate", Type: ConfigTypeBool, Description: "자동 업데이트"},
+	{Name: "AutoRestart", Type: ConfigTypeBool, Description: "오류 시 자동 재시작"},
+}
+
+type Config struct {
+	Revision int64                  `json:"Revision,omitempty"`
+	Values   map[string]interface{} `json:"Values,omitempty"`
+}
+
+// a config revision sent to devices
+type ConfigPush struct {
+	Config    Config
+	Timestamp int64
+	Targets   []string
+}
+
+type ConfigPushStatus struct {
+	ConfigPush
+
+	Applied []string
+	Pending []string
+}
+
+type remoteConfig struct {
+	pushes  []ConfigPush
+	applied map[string]int64
+	mutex   *sync.Mutex
+}
+
+func findConfigKey(name string) (ConfigKey, bool) {
+	for _, key := range ConfigSchema {
+		if key.Name == name {
+			return key, true
+		}
+	}
+
+	return ConfigKey{}, false
+}
+
+// ValidateConfig checks the values against ConfigSchema.
+func ValidateConfig(values map[string]interface{}) error {
+	if len(values) == 0 {
+		return fmt.Errorf("no config values")
+	}
+
+	for name, value := range values {
+		key, ok := findConfigKey(name)
+		if !ok {
+			return fmt.Errorf("unknown config key: %s", name)
+		}
+
+		switch key.Type {
+		case ConfigTypeBool:
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("%s: bool value required", name)
+			}
+		case ConfigTypeInt:
+			number, ok := value.(int)
+			if !ok {
+				return fmt.Errorf("%s: integer value required", name)
+			}
+			if number < key.Min || number > key.Max {
+				return fmt.Errorf("%s: value must be between %d and %d", name, key.Min, key.Max)
+			}
+		case ConfigTypeString:
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s: string value required", name)
+			}
+		case ConfigTypeEnum:
+			text, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s: string value required", name)
+			}
+			valid := false
+			for _, option := range key.Options {
+				if option == text {
+					valid = true
+				}
+			}
+			if !valid {
+				return fmt.Errorf("%s: value must be one of %v", name, key.Options)
+			}
+		}
+	}
+
+	return nil
+}
+
+// pushConfig sends the values to the given devices, or to every alive device if none given.
+func (manager *Manager) pushConfig(values map[string]interface{}, deviceIds []string) {
+	if err := ValidateConfig(values); err != nil {
+		logger.With("command", CommandConfig).LogE(err)
+		return
+	}
+
+	config := Config{Revision: time.Now().UnixNano(), Values: values}
+	command := Command{Type: CommandConfig, Config: &config}
+
+	targets := []*DeviceInfo{}
+	if len(deviceIds) == 0 {
+		for _, device := range manager.GetTotalDevices() {
+			if device.Alive && SupportsCommand(device, command.Type) {
+				targets = append(targets, device)
+			}
+		}
+	} else {
+		for _, deviceId := range deviceIds {
+			if device := manager.GetDevice(deviceId); device != nil {
+				targets = append(targets, device)
+			}
+		}
+	}
+
+	push := ConfigPush{Config: config, Timestamp: time.Now().Unix()}
+	for _, device := range targets {
+		if err := manager.publishCommand(device, command); err != nil {
+			commandLogger(device, command.Type).LogE(err)
+			continue
+		}
+		push.Targets = append(push.Targets, device.DeviceId)
+	}
+
+	manager.remoteConfig.mutex.Lock()
+	manager.remoteConfig.pushes = append(manager.remoteConfig.pushes, push)
+	manager.remoteConfig.mutex.Unlock()
+}
+
+// updateAppliedConfig records the config revision a device reported in its poa/info.
+func (manager *Manager) updateAppliedConfig(deviceInfo *DeviceInfo) {
+	if deviceInfo.ConfigRevision == 0 {
+		return
+	}
+
+	manager.remoteConfig.mutex.Lock()
+	if deviceInfo.ConfigRevision > manager.remoteConfig.applied[deviceInfo.DeviceId] {
+		manager.remoteConfig.applied[deviceInfo.DeviceId] = deviceInfo.ConfigRevision
+	}
+	manager.remoteConfig.mutex.Unlock()
+}
+
+// GetConfigPushStatus returns the sent config revisions with the devices which applied them, the most recent first.
+func (manager *Manager) GetConfigPushStatus() []ConfigPushStatus {
+	for _, device := range manager.GetTotalDevices() {
+		manager.updateAppliedConfig(device)
+	}
+
+	manager.remoteConfig.mutex.Lock()
+	defer manager.remoteConfig.mutex.Unlock()
+
+	statuses := []ConfigPushStatus{}
+	for _, push := range manager.remoteConfig.pushes {
+		status := ConfigPushStatus{ConfigPush: push}
+		for _, deviceId := range push.Targets {
+			if manager.remoteConfig.applied[deviceId] >= push.Config.Revision {
+				status.Applied = append(status.Applied, deviceId)
+			} else {
+				status.Pending = append(status.Pending, deviceId)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Config.Revision > statuses[j].Config.Revision
+	})
+
+	return statuses
+}
@@ -0,0 +1,220 @@
+package manager
+
+import (
+	"sync"
+	"time"
+
+	"poa-manager/auth"
+	"poa-manager/context"
+)
+
+const retentionReportMax = 20
+
+type RetentionPolicy struct {
+	Enabled          bool
+	DryRun           bool
+	Days             int
+	CheckIntervalSec int
+}
+
+// result of a single prune run, shown in the status page
+type RetentionReport struct {
+	Timestamp int64
+	DryRun    bool
+	Days      int
+
+	Devices []DeviceInfo
+	Failed  []string
+}
+
+type retention struct {
+	policy   RetentionPolicy
+	stopChan chan struct{}
+
+	reports []RetentionReport
+	mutex   *sync.Mutex
+}
+
+func retentionPolicy(configs *context.Configs) RetentionPolicy {
+	return RetentionPolicy{
+		Enabled:          configs.RetentionEnabled,
+		DryRun:           configs.RetentionDryRun,
+		Days:             configs.RetentionDays,
+		CheckIntervalSec: configs.RetentionCheckIntervalSec,
+	}
+}
+
+func (manager *Manager) initRetention(poaContext *context.Context) {
+	manager.retention = retention{mutex: &sync.Mutex{}}
+	manager.retention.policy = retentionPolicy(&poaContext.Configs)
+}
+
+// startRetention starts the scheduler of the policy, stopping the previous one.
+func (manager *Manager) startRetention() {
+	manager.retention.mutex.Lock()
+	defer manager.retention.mutex.Unlock()
+
+	if manager.retention.stopChan != nil {
+		close(manager.retention.stopChan)
+		manager.retention.stopChan = nil
+	}
+
+	policy := manager.retention.policy
+	if !policy.Enabled || policy.Days <= 0 || policy.CheckIntervalSec <= 0 {
+		return
+	}
+
+	stopChan := make(chan struct{})
+	manager.retention.stopChan = stopChan
+
+	go func() {
+		ticker := time.NewTicker(time.Second * time.Duration(policy.CheckIntervalSec))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+			}
+
+			// the scheduler is configured by an admin and runs without an operator session
+			report := manager.pruneStaleDevices(policy.Days, policy.DryRun)
+			if len(report.Devices) > 0 {
+				if report.DryRun {
+					manager.addRetentionReport(report)
+				}
+				logger.LogfI("retention: %d stale devices (days: %d, dry run: %v)", len(report.Devices), policy.Days, policy.DryRun)
+			}
+		}
+	}()
+}
+
+// UpdateRetentionPolicy applies the retention settings of the configs without a restart.
+func (manager *Manager) UpdateRetentionPolicy(configs *context.Configs) {
+	policy := retentionPolicy(configs)
+
+	manager.retention.mutex.Lock()
+	changed := manager.retention.policy != policy
+	manager.retention.policy = policy
+	manager.retention.mutex.Unlock()
+
+	if changed {
+		logger.LogfI("retention policy changed (enabled: %v, days: %d, dry run: %v)", policy.Enabled, policy.Days, policy.DryRun)
+		manager.startRetention()
+	}
+}
+
+func (manager *Manager) GetRetentionPolicy() RetentionPolicy {
+	manager.retention.mutex.Lock()
+	defer manager.retention.mutex.Unlock()
+
+	return manager.retention.policy
+}
+
+// StaleDeadDevices returns the dead devices whose last contact is older than the given days.
+func (manager *Manager) StaleDeadDevices(days int) []*DeviceInfo {
+	staleDevices := []*DeviceInfo{}
+	threshold := time.Now().AddDate(0, 0, -days).Unix()
+
+	for _, device := range manager.GetDeadDevices() {
+		if !device.Alive && device.Timestamp < threshold {
+			staleDevices = append(staleDevices, device)
+		}
+	}
+
+	return staleDevices
+}
+
+// RemoveDeviceList removes the devices one by one and returns the removed ids.
+func (manager *Manager) RemoveDeviceList(ids []string) (removed []string, failed []string) {
+	if err := auth.Check(auth.PermissionRemove); err != nil {
+		logger.With("devices", len(ids)).LogE(err)
+		return nil, ids
+	}
+
+	return manager.removeDeviceList(ids)
+}
+
+func (manager *Manager) removeDeviceList(ids []string) (removed []string, failed []string) {
+	for _, id := range ids {
+		if ok, _ := manager.removeDevice(id); ok {
+			removed = append(removed, id)
+		} else {
+			failed = append(failed, id)
+		}
+	}
+
+	if len(removed) > 0 {
+		manager.condChan <- 0
+	}
+
+	return
+}
+
+// PruneStaleDevices removes the dead devices not seen for the given days.
+// With dryRun, nothing is removed and the report only lists the candidates.
+func (manager *Manager) PruneStaleDevices(days int, dryRun bool) RetentionReport {
+	if !dryRun {
+		if err := auth.Check(auth.PermissionRemove); err != nil {
+			logger.LogE(err)
+			return RetentionReport{Timestamp: time.Now().Unix(), Days: days}
+		}
+	}
+
+	return manager.pruneStaleDevices(days, dryRun)
+}
+
+func (manager *Manager) pruneStaleDevices(days int, dryRun bool) RetentionReport {
+	report := RetentionReport{Timestamp: time.Now().Unix(), DryRun: dryRun, Days: days}
+
+	staleDevices := manager.StaleDeadDevices(days)
+	if dryRun {
+		for _, device := range staleDevices {
+			report.Devices = append(report.Devices, *device)
+		}
+		return report
+	}
+
+	ids := []string{}
+	for _, device := range staleDevices {
+		ids = append(ids, device.DeviceId)
+	}
+
+	removed, failed := manager.removeDeviceList(ids)
+	for _, id := range removed {
+		for _, device := range staleDevices {
+			if device.DeviceId == id {
+				report.Devices = append(report.Devices, *device)
+			}
+		}
+	}
+	report.Failed = failed
+
+	if len(report.Devices) > 0 || len(report.Failed) > 0 {
+		manager.addRetentionReport(report)
+	}
+
+	return report
+}
+
+func (manager *Manager) addRetentionReport(report RetentionReport) {
+	manager.retention.mutex.Lock()
+	defer manager.retention.mutex.Unlock()
+
+	manager.retention.reports = append(manager.retention.reports, report)
+	if len(manager.retention.reports) > retentionReportMax {
+		manager.retention.reports = manager.retention.reports[len(manager.retention.reports)-retentionReportMax:]
+	}
+}
+
+// GetRetentionReports returns the prune history, the most recent last.
+func (manager *Manager) GetRetentionReports() []RetentionReport {
+	manager.retention.mutex.Lock()
+	defer manager.retention.mutex.Unlock()
+
+	reports := make([]RetentionReport, len(manager.retention.reports))
+	copy(reports, manager.retention.reports)
+
+	return reports
+}
@@ -0,0 +1,131 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Wol struct {
+	MacAddress       string `json:"MacAddress,omitempty"`
+	BroadcastAddress string `json:"BroadcastAddress,omitempty"`
+}
+
+// wake request sent through an alive peer, done when the device sends poa/info again
+type WakeRequest struct {
+	DeviceId    string
+	PeerId      string
+	RequestTime int64
+	Woken       bool
+	WokenTime   int64
+}
+
+type wakeRequests struct {
+	requests map[string]*WakeRequest
+	mutex    *sync.Mutex
+}
+
+func broadcastAddress(privateIp string, prefixLength int) string {
+	ip := net.ParseIP(privateIp).To4()
+	if ip == nil || prefixLength <= 0 || prefixLength > 32 {
+		return "255.255.255.255"
+	}
+
+	mask := net.CIDRMask(prefixLength, 32)
+	broadcast := make(net.IP, 4)
+	for i := range ip {
+		broadcast[i] = ip[i] | ^mask[i]
+	}
+
+	return broadcast.String()
+}
+
+// findWakePeer selects an alive device behind the same public ip, preferring
+// the same private subnet and then the most recently seen one.
+func (manager *Manager) findWakePeer(device *DeviceInfo, prefixLength int) *DeviceInfo {
+	subnet := PrivateSubnet(device.PrivateIp, prefixLength)
+
+	peers := []*DeviceInfo{}
+	for _, peer := range manager.GetTotalDevices() {
+		if peer.DeviceId != device.DeviceId && peer.Alive && peer.PublicIp == device.PublicIp && SupportsCommand(peer, CommandWol) {
+			peers = append(peers, peer)
+		}
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		sameI := subnet != "" && PrivateSubnet(peers[i].PrivateIp, prefixLength) == subnet
+		sameJ := subnet != "" && PrivateSubnet(peers[j].PrivateIp, prefixLength) == subnet
+		if sameI != sameJ {
+			return sameI
+		}
+		return peers[i].Timestamp > peers[j].Timestamp
+	})
+
+	if len(peers) == 0 {
+		return nil
+	}
+
+	return peers[0]
+}
+
+// WakeDevice asks an alive peer on the same network to send a magic packet to the dead device.
+func (manager *Manager) WakeDevice(deviceId string, prefixLength int) (*DeviceInfo, error) {
+	device := manager.GetDevice(deviceId)
+	if device == nil {
+		return nil, fmt.Errorf("unknown device: %s", deviceId)
+	}
+	if device.MacAddress == "" {
+		return nil, fmt.Errorf("no mac address: %s", deviceId)
+	}
+
+	peer := manager.findWakePeer(device, prefixLength)
+	if peer == nil {
+		return nil, fmt.Errorf("no alive peer behind %s", device.PublicIp)
+	}
+
+	broadcast := "255.255.255.255"
+	if subnet := PrivateSubnet(device.PrivateIp, prefixLength); subnet != "" && subnet == PrivateSubnet(peer.PrivateIp, prefixLength) {
+		broadcast = broadcastAddress(device.PrivateIp, prefixLength)
+	}
+
+	command := Command{Type: CommandWol, Wol: &Wol{MacAddress: device.MacAddress, BroadcastAddress: broadcast}}
+	if err := manager.publishCommand(peer, command); err != nil {
+		return nil, err
+	}
+
+	manager.wakeRequests.mutex.Lock()
+	manager.wakeRequests.requests[deviceId] = &WakeRequest{DeviceId: deviceId, PeerId: peer.DeviceId, RequestTime: time.Now().Unix()}
+	manager.wakeRequests.mutex.Unlock()
+
+	return peer, nil
+}
+
+func (manager *Manager) confirmWake(deviceInfo *DeviceInfo) {
+	manager.wakeRequests.mutex.Lock()
+	defer manager.wakeRequests.mutex.Unlock()
+
+	request, ok := manager.wakeRequests.requests[deviceInfo.DeviceId]
+	if !ok || request.Woken || deviceInfo.Timestamp < request.RequestTime {
+		return
+	}
+
+	request.Woken = true
+	request.WokenTime = time.Now().Unix()
+
+	logger.With("device", deviceInfo.DeviceId, "command", CommandWol).LogfI("device woke up: %s (peer: %s)", deviceInfo.DeviceId, request.PeerId)
+}
+
+// GetWakeRequest returns the last wake request of the device.
+func (manager *Manager) GetWakeRequest(deviceId string) (WakeRequest, bool) {
+	manager.wakeRequests.mutex.Lock()
+	defer manager.wakeRequests.mutex.Unlock()
+
+	request, ok := manager.wakeRequests.requests[deviceId]
+	if !ok {
+		return WakeRequest{}, false
+	}
+
+	return *request, true
+}
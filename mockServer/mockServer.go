@@ -0,0 +1,326 @@
+package mockServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"poa-manager/log"
+	"poa-manager/manager"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var logger log.Logger = log.NewLogger("mockServer")
+
+var infoTopicRegexp = regexp.MustCompile(`^mine/[^/]+/[^/]+/poa/info$`)
+
+type Options struct {
+	Address string
+	Port    int
+
+	// a device without poa/info for this duration is reported as dead
+	DeadTimeout time.Duration
+
+	// the server is fed by poa/info messages if the broker address is set
+	MqttBrokerAddress string
+	MqttPort          int
+	MqttUser          string
+	MqttPassword      string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Address:     "localhost",
+		Port:        8080,
+		DeadTimeout: time.Minute,
+		MqttPort:    1883,
+	}
+}
+
+type device struct {
+	info     manager.DeviceInfo
+	lastSeen time.Time
+}
+
+// MockServer implements the device api of the PoA server with in-memory state.
+type MockServer struct {
+	options Options
+
+	devices map[string]*device
+	mutex   *sync.Mutex
+
+	server     *http.Server
+	listener   net.Listener
+	mqttClient mqtt.Client
+
+	stopCh chan int
+}
+
+func NewMockServer(options Options) *MockServer {
+	if options.DeadTimeout <= 0 {
+		options.DeadTimeout = DefaultOptions().DeadTimeout
+	}
+
+	return &MockServer{
+		options: options,
+		devices: map[string]*device{},
+		mutex:   &sync.Mutex{},
+		stopCh:  make(chan int),
+	}
+}
+
+// Start listens on the configured address. Port 0 picks a free port, see Port.
+func (mockServer *MockServer) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", mockServer.options.Address, mockServer.options.Port))
+	if err != nil {
+		return err
+	}
+	mockServer.listener = listener
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device/status", mockServer.handleStatus)
+	mux.HandleFunc("/device/list", mockServer.handleList)
+	mux.HandleFunc("/device/dead/list", mockServer.handleDeadList)
+	mux.HandleFunc("/device/remove/", mockServer.handleRemove)
+
+	mockServer.server = &http.Server{Handler: mux}
+	go func() {
+		if err := mockServer.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.LogE(err)
+		}
+	}()
+
+	logger.LogfI("mock server listening on %s", listener.Addr())
+
+	if mockServer.options.MqttBrokerAddress != "" {
+		if err := mockServer.connectMqtt(); err != nil {
+			mockServer.Stop()
+			return err
+		}
+	}
+
+	go mockServer.watchDeadDevices()
+
+	return nil
+}
+
+// watchDeadDevices notifies the managers when a device dies or comes back.
+func (mockServer *MockServer) watchDeadDevices() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var deadIds []string
+	for {
+		select {
+		case <-ticker.C:
+			_, dead := mockServer.Devices()
+			ids := []string{}
+			for _, device := range dead {
+				ids = append(ids, device.DeviceId)
+			}
+			if deadIds != nil && strings.Join(ids, ",") != strings.Join(deadIds, ",") {
+				mockServer.notifyUpdated()
+			}
+			deadIds = ids
+		case <-mockServer.stopCh:
+			return
+		}
+	}
+}
+
+func (mockServer *MockServer) Stop() {
+	close(mockServer.stopCh)
+
+	if mockServer.mqttClient != nil {
+		mockServer.mqttClient.Disconnect(250)
+	}
+	if mockServer.server != nil {
+		mockServer.server.Close()
+	}
+}
+
+// Port returns the port the server is listening on.
+func (mockServer *MockServer) Port() int {
+	if mockServer.listener == nil {
+		return mockServer.options.Port
+	}
+
+	return mockServer.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (mockServer *MockServer) connectMqtt() error {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", mockServer.options.MqttBrokerAddress, mockServer.options.MqttPort))
+	opts.SetClientID(fmt.Sprintf("poa-mock-server-%d", rand.Int31n(10000000)))
+	opts.SetUsername(mockServer.options.MqttUser)
+	opts.SetPassword(mockServer.options.MqttPassword)
+	opts.SetAutoReconnect(true)
+	opts.OnConnect = func(client mqtt.Client) {
+		client.Subscribe("mine/+/+/poa/info", 1, mockServer.mqttHandler)
+	}
+
+	mockServer.mqttClient = mqtt.NewClient(opts)
+	if token := mockServer.mqttClient.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	return nil
+}
+
+func (mockServer *MockServer) mqttHandler(client mqtt.Client, msg mqtt.Message) {
+	if !infoTopicRegexp.MatchString(msg.Topic()) {
+		return
+	}
+
+	info := manager.DeviceInfo{}
+	if err := json.Unmarshal(msg.Payload(), &info); err != nil {
+		logger.LogE(err)
+		return
+	}
+
+	mockServer.PutDevice(info)
+}
+
+// notifyUpdated tells the managers to reload the device list, as the real server does.
+func (mockServer *MockServer) notifyUpdated() {
+	if mockServer.mqttClient != nil && mockServer.mqttClient.IsConnected() {
+		mockServer.mqttClient.Publish("mine/server/updated", 1, false, "")
+	}
+}
+
+// PutDevice registers the device or refreshes it as if it has just reported.
+func (mockServer *MockServer) PutDevice(info manager.DeviceInfo) {
+	if info.DeviceId == "" {
+		return
+	}
+
+	mockServer.mutex.Lock()
+	_, exists := mockServer.devices[info.DeviceId]
+	mockServer.devices[info.DeviceId] = &device{info: info, lastSeen: time.Now()}
+	mockServer.mutex.Unlock()
+
+	if !exists {
+		mockServer.notifyUpdated()
+	}
+}
+
+// SetLastSeen moves the last report time of the device, to make it dead or stale.
+func (mockServer *MockServer) SetLastSeen(deviceId string, lastSeen time.Time) bool {
+	mockServer.mutex.Lock()
+	defer mockServer.mutex.Unlock()
+
+	d, ok := mockServer.devices[deviceId]
+	if ok {
+		d.lastSeen = lastSeen
+		d.info.Timestamp = lastSeen.Unix()
+	}
+
+	return ok
+}
+
+// Devices returns all registered devices and the dead ones among them.
+func (mockServer *MockServer) Devices() (total []*manager.DeviceInfo, dead []*manager.DeviceInfo) {
+	mockServer.mutex.Lock()
+	defer mockServer.mutex.Unlock()
+
+	ids := []string{}
+	for id := range mockServer.devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	now := time.Now()
+	total = []*manager.DeviceInfo{}
+	dead = []*manager.DeviceInfo{}
+	for _, id := range ids {
+		d := mockServer.devices[id]
+		info := d.info
+		info.Alive = now.Sub(d.lastSeen) < mockServer.options.DeadTimeout
+
+		total = append(total, &info)
+		if !info.Alive {
+			dead = append(dead, &info)
+		}
+	}
+
+	return
+}
+
+func (mockServer *MockServer) writeResponse(w http.ResponseWriter, response manager.Response) {
+	doc, err := json.Marshal(response)
+	if err != nil {
+		logger.LogE(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
+
+func (mockServer *MockServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	total, dead := mockServer.Devices()
+
+	mockServer.writeResponse(w, manager.Response{
+		Type: "status",
+		Device: &manager.Device{
+			TotalNum:   len(total),
+			DeadDevice: &manager.DeadDevice{Num: len(dead)},
+		},
+	})
+}
+
+func (mockServer *MockServer) handleList(w http.ResponseWriter, r *http.Request) {
+	total, dead := mockServer.Devices()
+
+	mockServer.writeResponse(w, manager.Response{
+		Type: "list",
+		Device: &manager.Device{
+			List:       total,
+			TotalNum:   len(total),
+			DeadDevice: &manager.DeadDevice{List: dead, Num: len(dead)},
+		},
+	})
+}
+
+func (mockServer *MockServer) handleDeadList(w http.ResponseWriter, r *http.Request) {
+	_, dead := mockServer.Devices()
+
+	mockServer.writeResponse(w, manager.Response{
+		Type: "deadList",
+		Device: &manager.Device{
+			DeadDevice: &manager.DeadDevice{List: dead, Num: len(dead)},
+		},
+	})
+}
+
+func (mockServer *MockServer) handleRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/device/remove/")
+
+	removed := []string{}
+	mockServer.mutex.Lock()
+	if _, ok := mockServer.devices[id]; ok {
+		delete(mockServer.devices, id)
+		removed = append(removed, id)
+	}
+	mockServer.mutex.Unlock()
+
+	if len(removed) > 0 {
+		mockServer.notifyUpdated()
+	}
+
+	mockServer.writeResponse(w, manager.Response{Type: "remove", Remove: &manager.Remove{List: removed}})
+}
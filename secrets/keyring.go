@@ -0,0 +1,94 @@
+//go:build !windows
+
+package secrets
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// The keyring is used through the os tools so no cgo or dbus binding is needed:
+// secret-tool (libsecret) on linux and security (keychain) on macOS.
+func keyringTool() (string, error) {
+	var tool string
+	switch runtime.GOOS {
+	case "linux", "freebsd":
+		tool = "secret-tool"
+	case "darwin":
+		tool = "security"
+	default:
+		return "", ErrKeyringUnavailable
+	}
+
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return "", ErrKeyringUnavailable
+	}
+	return path, nil
+}
+
+func KeyringAvailable() bool {
+	_, err := keyringTool()
+	return err == nil
+}
+
+// KeyringGet returns the secret stored for the account.
+func KeyringGet(account string) (string, error) {
+	tool, err := keyringTool()
+	if err != nil {
+		return "", err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command(tool, "find-generic-password", "-s", keyringService, "-a", account, "-w")
+	} else {
+		cmd = exec.Command(tool, "lookup", "service", keyringService, "account", account)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimRight(string(out), "\r\n")
+	if secret == "" {
+		return "", errors.New("no secret in os keyring")
+	}
+	return secret, nil
+}
+
+// KeyringSet stores the secret for the account, replacing the previous one.
+func KeyringSet(account, secret string) error {
+	tool, err := keyringTool()
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		// the secret is not passed as an argument, the process list shows them to every user.
+		// security reads the command from stdin in interactive mode.
+		cmd = exec.Command(tool, "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n",
+			securityQuote(keyringService), securityQuote(account), hex.EncodeToString([]byte(secret))))
+	} else {
+		cmd = exec.Command(tool, "store", "--label=PoA Manager config key", "service", keyringService, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		logger.LogE(strings.TrimSpace(string(out)))
+		return err
+	}
+	return nil
+}
+
+// securityQuote quotes an argument of a command line of security -i.
+func securityQuote(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// The keyring is the windows credential manager, called through advapi32 so no cgo is needed.
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// CREDENTIALW
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+var (
+	advapi32      = syscall.NewLazyDLL("advapi32.dll")
+	procCredRead  = advapi32.NewProc("CredReadW")
+	procCredWrite = advapi32.NewProc("CredWriteW")
+	procCredFree  = advapi32.NewProc("CredFree")
+)
+
+func credentialTarget(account string) string {
+	return keyringService + ":" + account
+}
+
+func KeyringAvailable() bool {
+	return procCredRead.Find() == nil && procCredWrite.Find() == nil && procCredFree.Find() == nil
+}
+
+// KeyringGet returns the secret stored for the account.
+func KeyringGet(account string) (string, error) {
+	if !KeyringAvailable() {
+		return "", ErrKeyringUnavailable
+	}
+
+	target, err := syscall.UTF16PtrFromString(credentialTarget(account))
+	if err != nil {
+		return "", err
+	}
+
+	var cred *credential
+	ret, _, err := procCredRead.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ret == 0 {
+		if err == errorNotFound {
+			return "", errors.New("no secret in os keyring")
+		}
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	if cred.CredentialBlobSize == 0 {
+		return "", errors.New("no secret in os keyring")
+	}
+
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+// KeyringSet stores the secret for the account, replacing the previous one.
+func KeyringSet(account, secret string) error {
+	if !KeyringAvailable() {
+		return ErrKeyringUnavailable
+	}
+	if secret == "" {
+		return errors.New("empty secret")
+	}
+
+	target, err := syscall.UTF16PtrFromString(credentialTarget(account))
+	if err != nil {
+		return err
+	}
+	userName, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+	comment, err := syscall.UTF16PtrFromString("PoA Manager config key")
+	if err != nil {
+		return err
+	}
+
+	blob := []byte(secret)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		Comment:            comment,
+		CredentialBlobSize: uint32(len(blob)),
+		CredentialBlob:     &blob[0],
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+
+	if ret, _, err := procCredWrite.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		logger.LogE(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package secrets
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"poa-manager/log"
+)
+
+var logger log.Logger = log.NewLogger("secrets")
+
+const (
+	KeySize = 32
+
+	PassphraseEnv = "POA_CONFIG_PASSPHRASE"
+
+	keyringService = "poa-manager"
+)
+
+var (
+	ErrNoPassphrase       = errors.New("no passphrase available")
+	ErrKeyringUnavailable = errors.New("os keyring is not available")
+)
+
+// Pbkdf2 with hmac-sha256, the standard library has no key derivation function
+func Pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	buf := make([]byte, 4)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf, uint32(block))
+		prf.Write(buf)
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
+
+func RandomBytes(size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Seal encrypts the text with AES-GCM and returns base64(nonce | ciphertext).
+func Seal(key []byte, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := RandomBytes(gcm.NonceSize())
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plain), nil)), nil
+}
+
+// Open decrypts a text sealed by Seal.
+func Open(key []byte, sealed string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	doc, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(doc) < gcm.NonceSize() {
+		return "", errors.New("sealed secret is too short")
+	}
+
+	plain, err := gcm.Open(nil, doc[:gcm.NonceSize()], doc[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("cannot decrypt secret, wrong key")
+	}
+
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadPassphrase returns PassphraseEnv or asks it on the terminal.
+// Without a terminal (e.g. the windows gui build) ErrNoPassphrase is returned.
+func ReadPassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return "", ErrNoPassphrase
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	if runtime.GOOS != "windows" {
+		stty := exec.Command("stty", "-echo")
+		stty.Stdin = os.Stdin
+		if stty.Run() == nil {
+			defer func() {
+				stty := exec.Command("stty", "echo")
+				stty.Stdin = os.Stdin
+				stty.Run()
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return "", ErrNoPassphrase
+	}
+
+	return passphrase, nil
+}
@@ -0,0 +1,368 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"poa-manager/manager"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// agent is a virtual PoA device publishing poa/info and honoring commands
+type agent struct {
+	simulator *Simulator
+
+	info   manager.DeviceInfo
+	client mqtt.Client
+
+	user     string
+	password string
+
+	payloadKey *manager.PayloadKey
+
+	// the agent does not publish until this time (restart gap or simulated death)
+	downUntil time.Time
+	logLines  []string
+
+	mutex *sync.Mutex
+}
+
+func newAgent(simulator *Simulator, index int) *agent {
+	network := index / simulator.options.DevicesPerNetwork
+	host := index%simulator.options.DevicesPerNetwork + 10
+
+	a := &agent{
+		simulator:  simulator,
+		user:       simulator.options.MqttUser,
+		password:   simulator.options.MqttPassword,
+		payloadKey: simulator.options.PayloadKey,
+		mutex:      &sync.Mutex{},
+	}
+	a.info = manager.DeviceInfo{
+		SchemaVersion: manager.InfoSchemaVersion,
+		DeviceId:      fmt.Sprintf("sim-%06d", index),
+		MacAddress:    fmt.Sprintf("02:00:00:%02x:%02x:%02x", (index>>16)&0xff, (index>>8)&0xff, index&0xff),
+		PublicIp:      fmt.Sprintf("203.0.113.%d", network%254+1),
+		PrivateIp:     fmt.Sprintf("192.168.%d.%d", network%256, host),
+		Owner:         simulatedOwners[index%len(simulatedOwners)],
+		OwnNumber:     index/len(simulatedOwners) + 1,
+		DeviceType:    0,
+		DeviceDesc:    fmt.Sprintf("simulated device %d", index),
+		Version:       simulator.options.Version,
+	}
+
+	return a
+}
+
+var simulatedOwners = []string{"kim", "lee", "park", "choi", "jung", "kang", "cho", "yoon"}
+
+func (a *agent) topic(name string) string {
+	return fmt.Sprintf("mine/%s/%s/poa/%s", a.info.PublicIp, a.info.DeviceId, name)
+}
+
+func (a *agent) connect() error {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(a.simulator.brokerUrl())
+	opts.SetClientID(fmt.Sprintf("poa-simulator-%s-%d", a.info.DeviceId, rand.Int31n(10000000)))
+	a.mutex.Lock()
+	opts.SetUsername(a.user)
+	opts.SetPassword(a.password)
+	a.mutex.Unlock()
+	opts.SetAutoReconnect(true)
+	opts.OnConnect = func(client mqtt.Client) {
+		client.Subscribe(a.topic("command"), 1, a.commandHandler)
+	}
+
+	// the lock is not held while connecting, the command handler takes it
+	client := mqtt.NewClient(opts)
+	a.mutex.Lock()
+	a.client = client
+	a.mutex.Unlock()
+
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	return nil
+}
+
+func (a *agent) disconnect() {
+	a.mutex.Lock()
+	client := a.client
+	a.client = nil
+	a.mutex.Unlock()
+
+	if client != nil {
+		client.Disconnect(250)
+	}
+}
+
+func (a *agent) alive(now time.Time) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return now.After(a.downUntil)
+}
+
+func (a *agent) goDown(duration time.Duration) {
+	a.mutex.Lock()
+	a.downUntil = time.Now().Add(duration)
+	a.mutex.Unlock()
+}
+
+// tick publishes poa/info unless the agent is down, and sometimes kills it.
+func (a *agent) tick(now time.Time) {
+	options := a.simulator.options
+
+	if !a.alive(now) {
+		return
+	}
+
+	if rand.Float64() < options.DeathRate {
+		duration := options.MinDeadTime + time.Duration(rand.Int63n(int64(options.MaxDeadTime-options.MinDeadTime)+1))
+		a.log("simulated failure, down for %v", duration)
+		a.goDown(duration)
+		return
+	}
+
+	a.publishInfo(now)
+}
+
+func (a *agent) publishInfo(now time.Time) {
+	a.mutex.Lock()
+	a.info.Timestamp = now.Unix()
+	doc, err := json.Marshal(a.info)
+	a.mutex.Unlock()
+
+	if err != nil {
+		logger.LogE(err)
+		return
+	}
+
+	a.publish(a.topic("info"), doc)
+}
+
+// publish encrypts the payload if the agent has a payload key.
+func (a *agent) publish(topic string, doc []byte) {
+	a.mutex.Lock()
+	key := a.payloadKey
+	client := a.client
+	a.mutex.Unlock()
+
+	if client == nil {
+		return
+	}
+	if key != nil {
+		var err error
+		if doc, err = manager.EncryptPayload(key, topic, doc); err != nil {
+			logger.LogE(err)
+			return
+		}
+	}
+
+	client.Publish(topic, 1, false, doc)
+}
+
+func (a *agent) log(f string, args ...interface{}) {
+	line := fmt.Sprintf("%s %s", time.Now().Format(logTimeFormat), fmt.Sprintf(f, args...))
+
+	a.mutex.Lock()
+	a.logLines = append(a.logLines, line)
+	if len(a.logLines) > 1000 {
+		a.logLines = a.logLines[len(a.logLines)-1000:]
+	}
+	a.mutex.Unlock()
+}
+
+func (a *agent) commandHandler(client mqtt.Client, msg mqtt.Message) {
+	a.mutex.Lock()
+	key := a.payloadKey
+	a.mutex.Unlock()
+
+	payload, keyId, err := manager.DecryptPayload([]*manager.PayloadKey{key}, msg.Topic(), msg.Payload())
+	if err != nil {
+		a.log("rejected command: %v", err)
+		return
+	}
+	if key != nil && keyId == "" {
+		a.log("rejected plain command")
+		return
+	}
+
+	if !a.alive(time.Now()) {
+		return
+	}
+
+	var command manager.Command
+	if verifyKey := a.simulator.options.VerifyKey; verifyKey != nil {
+		if command, err = manager.VerifyCommand(verifyKey, a.info.DeviceId, payload); err != nil {
+			a.log("rejected command: %v", err)
+			return
+		}
+		if !a.simulator.useNonce(command.Signature.Nonce, command.Signature.Expiry) {
+			a.log("rejected replayed %s command", command.Type)
+			return
+		}
+	} else if command, err = manager.UnwrapCommand(payload); err != nil {
+		logger.LogE(err)
+		return
+	}
+
+	logger.LogfD("%s <- %s", a.info.DeviceId, command.Type)
+	a.log("command: %s", command.Type)
+
+	switch command.Type {
+	case manager.CommandRestart:
+		// a restart leaves a gap in the info messages
+		a.goDown(time.Second * time.Duration(5+rand.Intn(15)))
+
+	case manager.CommandUpdate:
+		if command.Update != nil && command.Update.ForceUpdate {
+			a.mutex.Lock()
+			a.info.Version = bumpPatchVersion(a.info.Version)
+			a.mutex.Unlock()
+			a.goDown(time.Second * 5)
+		}
+
+	case manager.CommandMqtt:
+		if command.Mqtt != nil {
+			a.mutex.Lock()
+			a.user = command.Mqtt.MqttUser
+			a.password = command.Mqtt.MqttPassword
+			a.mutex.Unlock()
+			go func() {
+				a.disconnect()
+				if err := a.connect(); err != nil {
+					a.log("mqtt reconnect failed: %v", err)
+					logger.LogE(err)
+				}
+			}()
+		}
+
+	case manager.CommandInfo:
+		if command.Info != nil {
+			a.mutex.Lock()
+			a.info.Owner = command.Info.Owner
+			a.info.OwnNumber = command.Info.OwnNumber
+			a.info.DeviceDesc = command.Info.DeviceDesc
+			a.mutex.Unlock()
+			a.publishInfo(time.Now())
+		}
+
+	case manager.CommandConfig:
+		if command.Config != nil {
+			a.mutex.Lock()
+			a.info.ConfigRevision = command.Config.Revision
+			a.mutex.Unlock()
+			a.publishInfo(time.Now())
+		}
+
+	case manager.CommandLog:
+		if command.Log != nil {
+			a.replyLog(command.Log)
+		}
+
+	case manager.CommandDiag:
+		if command.Diag != nil {
+			a.replyDiag(command.Diag)
+		}
+
+	case manager.CommandKey:
+		if command.Key != nil {
+			a.mutex.Lock()
+			a.payloadKey = command.Key
+			a.mutex.Unlock()
+			a.log("payload key changed: %s", command.Key.KeyId)
+			a.publishInfo(time.Now())
+		}
+
+	case manager.CommandWol:
+		if command.Wol != nil {
+			a.simulator.wake(command.Wol.MacAddress)
+		}
+	}
+}
+
+const logTimeFormat = "2006-01-02 15:04:05"
+
+func (a *agent) replyLog(request *manager.LogRequest) {
+	a.mutex.Lock()
+	lines := append([]string{}, a.logLines...)
+	a.mutex.Unlock()
+
+	if request.Since > 0 {
+		inRange := []string{}
+		for _, line := range lines {
+			t, err := time.ParseInLocation(logTimeFormat, line[:len(logTimeFormat)], time.Local)
+			if err != nil || t.Unix() < request.Since || (request.Until > 0 && t.Unix() > request.Until) {
+				continue
+			}
+			inRange = append(inRange, line)
+		}
+		lines = inRange
+	}
+	if request.Lines > 0 && len(lines) > request.Lines {
+		lines = lines[len(lines)-request.Lines:]
+	}
+	text := strings.Join(lines, "\n") + "\n"
+
+	const chunkSize = 4096
+	total := (len(text) + chunkSize - 1) / chunkSize
+	for seq := 0; seq < total; seq++ {
+		end := (seq + 1) * chunkSize
+		if end > len(text) {
+			end = len(text)
+		}
+
+		doc, _ := json.Marshal(manager.LogChunk{RequestId: request.RequestId, Seq: seq, Total: total, Data: text[seq*chunkSize : end]})
+		a.publish(request.ReplyTopic, doc)
+	}
+}
+
+func (a *agent) replyDiag(request *manager.DiagRequest) {
+	result := manager.DiagResult{
+		RequestId:  request.RequestId,
+		Kind:       request.Kind,
+		Target:     request.Target,
+		Success:    true,
+		DurationMs: int64(5 + rand.Intn(50)),
+		Values:     map[string]string{},
+	}
+
+	switch request.Kind {
+	case manager.DiagPing:
+		result.Values["loss"] = "0%"
+		result.Values["avg"] = fmt.Sprintf("%d ms", 1+rand.Intn(30))
+	case manager.DiagDns:
+		result.Values["address"] = fmt.Sprintf("198.51.100.%d", 1+rand.Intn(254))
+	case manager.DiagRoute:
+		result.Output = fmt.Sprintf("default via %s dev eth0\n", strings.Join(strings.Split(a.info.PrivateIp, ".")[:3], ".")+".1")
+	case manager.DiagInterfaces:
+		result.Output = fmt.Sprintf("eth0: %s %s\n", a.info.PrivateIp, a.info.MacAddress)
+	case manager.DiagDisk:
+		result.Values["used"] = fmt.Sprintf("%d%%", 20+rand.Intn(70))
+	}
+
+	doc, _ := json.Marshal(result)
+	a.publish(request.ReplyTopic, doc)
+}
+
+func bumpPatchVersion(version string) string {
+	split := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(split) != 3 {
+		return version
+	}
+
+	patch, err := strconv.Atoi(split[2])
+	if err != nil {
+		return version
+	}
+
+	return fmt.Sprintf("v%s.%s.%d", split[0], split[1], patch+1)
+}
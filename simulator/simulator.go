@@ -0,0 +1,173 @@
+package simulator
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"poa-manager/log"
+	"poa-manager/manager"
+)
+
+var logger log.Logger = log.NewLogger("simulator")
+
+type Options struct {
+	Devices           int
+	DevicesPerNetwork int
+	Interval          time.Duration
+
+	// probability that an alive agent dies on each tick
+	DeathRate   float64
+	MinDeadTime time.Duration
+	MaxDeadTime time.Duration
+
+	Version string
+
+	// agents reject unsigned, expired or replayed commands if set
+	VerifyKey ed25519.PublicKey
+
+	// agents encrypt their payloads with the key if set
+	PayloadKey *manager.PayloadKey
+
+	MqttBrokerAddress string
+	MqttPort          int
+	MqttUser          string
+	MqttPassword      string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Devices:           20,
+		DevicesPerNetwork: 8,
+		Interval:          time.Second * 10,
+		DeathRate:         0.005,
+		MinDeadTime:       time.Minute,
+		MaxDeadTime:       time.Minute * 10,
+		Version:           "v1.0.0",
+		MqttBrokerAddress: "localhost",
+		MqttPort:          1883,
+	}
+}
+
+// Simulator runs a fleet of virtual PoA agents against an mqtt broker.
+type Simulator struct {
+	options Options
+	agents  []*agent
+	stopCh  chan int
+	stopped *sync.Once
+
+	// nonces of the accepted commands and their expiry
+	nonces     map[string]int64
+	mutexNonce *sync.Mutex
+}
+
+func NewSimulator(options Options) *Simulator {
+	if options.DevicesPerNetwork <= 0 {
+		options.DevicesPerNetwork = 1
+	}
+	if options.MaxDeadTime < options.MinDeadTime {
+		options.MaxDeadTime = options.MinDeadTime
+	}
+
+	return &Simulator{options: options, stopCh: make(chan int), stopped: &sync.Once{}, nonces: map[string]int64{}, mutexNonce: &sync.Mutex{}}
+}
+
+func (simulator *Simulator) brokerUrl() string {
+	return fmt.Sprintf("tcp://%s:%d", simulator.options.MqttBrokerAddress, simulator.options.MqttPort)
+}
+
+func (simulator *Simulator) Start() error {
+	if simulator.options.Interval <= 0 {
+		return fmt.Errorf("invalid info interval: %v", simulator.options.Interval)
+	}
+
+	rand.Seed(time.Now().UnixNano())
+
+	logger.LogfI("start %d agents on %s", simulator.options.Devices, simulator.brokerUrl())
+
+	for i := 0; i < simulator.options.Devices; i++ {
+		a := newAgent(simulator, i)
+		if err := a.connect(); err != nil {
+			simulator.Stop()
+			return err
+		}
+		a.log("agent started")
+		simulator.agents = append(simulator.agents, a)
+	}
+
+	go func() {
+		ticker := time.NewTicker(simulator.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				for _, a := range simulator.agents {
+					a.tick(now)
+				}
+			case <-simulator.stopCh:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop disconnects the agents, it can be called more than once.
+func (simulator *Simulator) Stop() {
+	simulator.stopped.Do(func() {
+		close(simulator.stopCh)
+
+		for _, a := range simulator.agents {
+			a.disconnect()
+		}
+	})
+}
+
+// Kill makes the agent stop reporting for the duration, as if the device died.
+func (simulator *Simulator) Kill(deviceId string, duration time.Duration) bool {
+	for _, a := range simulator.agents {
+		if a.info.DeviceId == deviceId {
+			a.log("killed for %v", duration)
+			a.goDown(duration)
+			return true
+		}
+	}
+
+	return false
+}
+
+// useNonce returns false if the nonce has been used by an accepted command.
+func (simulator *Simulator) useNonce(nonce string, expiry int64) bool {
+	simulator.mutexNonce.Lock()
+	defer simulator.mutexNonce.Unlock()
+
+	now := time.Now().Unix()
+	for n, e := range simulator.nonces {
+		if e < now {
+			delete(simulator.nonces, n)
+		}
+	}
+
+	if _, ok := simulator.nonces[nonce]; ok {
+		return false
+	}
+	simulator.nonces[nonce] = expiry
+
+	return true
+}
+
+// wake brings back the agent with the mac address, as a magic packet would.
+func (simulator *Simulator) wake(macAddress string) {
+	for _, a := range simulator.agents {
+		if strings.EqualFold(a.info.MacAddress, macAddress) {
+			a.goDown(0)
+			a.log("woken up by magic packet")
+			a.publishInfo(time.Now())
+		}
+	}
+}
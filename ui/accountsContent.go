@@ -0,0 +1,168 @@
+package ui
+
+import (
+	"fmt"
+
+	"poa-manager/auth"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+type contentAccounts struct {
+	content      *fyne.Container
+	labelSession *widget.Label
+	accountList  *fyne.Container
+}
+
+func newAccountsContent() *contentAccounts {
+	accountsContent := contentAccounts{}
+
+	accountsContent.content = container.NewMax()
+	accountsContent.labelSession = widget.NewLabel("")
+	accountsContent.accountList = container.NewVBox()
+
+	toolbar := container.NewHBox(accountsContent.labelSession, layout.NewSpacer(),
+		widget.NewButton("비밀번호 변경", accountsContent.showChangePassword),
+		widget.NewButton("계정 추가", accountsContent.showAddAccount),
+		widget.NewButton("로그아웃", logout))
+
+	accountsContent.content.Add(container.NewBorder(toolbar, nil, nil, nil, container.NewVScroll(accountsContent.accountList)))
+
+	return &accountsContent
+}
+
+func (accountsContent *contentAccounts) GetContent() *fyne.Container {
+	return accountsContent.content
+}
+
+func (accountsContent *contentAccounts) SetMainContent() {
+	if parentContainer != nil {
+		parentContainer.Objects = []fyne.CanvasObject{accountsContent.content}
+		activeContect = accountsContent.content
+	}
+}
+
+func roleOptions() []string {
+	options := []string{}
+	for _, role := range auth.Roles {
+		options = append(options, role.Text())
+	}
+	return options
+}
+
+func roleOf(text string) auth.Role {
+	for _, role := range auth.Roles {
+		if role.Text() == text {
+			return role
+		}
+	}
+	return auth.RoleViewer
+}
+
+func (accountsContent *contentAccounts) updateView() {
+	session := auth.CurrentSession()
+	if session == nil {
+		accountsContent.labelSession.SetText("")
+		return
+	}
+	accountsContent.labelSession.SetText(fmt.Sprintf("로그인: %s (%s)", session.Name, session.Role.Text()))
+
+	objects := []fyne.CanvasObject{}
+	if session.Role.Has(auth.PermissionAccounts) {
+		for _, account := range accounts.List() {
+			account := account
+
+			selectRole := widget.NewSelect(roleOptions(), nil)
+			selectRole.SetSelected(account.Role.Text())
+			selectRole.OnChanged = func(text string) {
+				if err := accounts.SetRole(account.Name, roleOf(text)); err != nil {
+					dialog.ShowError(err, *window)
+				}
+				accountsContent.updateView()
+			}
+
+			buttonRemove := widget.NewButton("삭제", func() {
+				dialog.ShowConfirm("계정 삭제", fmt.Sprintf("%s 계정을 삭제하시겠습니까?", account.Name), func(ok bool) {
+					if ok {
+						if err := accounts.Remove(account.Name); err != nil {
+							dialog.ShowError(err, *window)
+						}
+						accountsContent.updateView()
+					}
+				}, *window)
+			})
+			if account.Name == session.Name {
+				selectRole.Disable()
+				buttonRemove.Disable()
+			}
+
+			objects = append(objects, container.NewHBox(widget.NewLabel(account.Name), layout.NewSpacer(), selectRole, buttonRemove))
+		}
+	} else {
+		objects = append(objects, widget.NewLabel("계정 관리는 관리자만 할 수 있습니다."))
+	}
+
+	accountsContent.accountList.Objects = objects
+	accountsContent.accountList.Refresh()
+}
+
+func (accountsContent *contentAccounts) showAddAccount() {
+	if !allowed(auth.PermissionAccounts) {
+		return
+	}
+
+	entryName := widget.NewEntry()
+	entryPassword := widget.NewPasswordEntry()
+	selectRole := widget.NewSelect(roleOptions(), nil)
+	selectRole.SetSelected(auth.RoleViewer.Text())
+
+	items := []*widget.FormItem{
+		{Text: "아이디", Widget: entryName},
+		{Text: "비밀번호", Widget: entryPassword},
+		{Text: "권한", Widget: selectRole},
+	}
+
+	dialog.ShowForm("계정 추가", "추가", "취소", items, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		if err := accounts.Add(entryName.Text, entryPassword.Text, roleOf(selectRole.Selected)); err != nil {
+			dialog.ShowError(err, *window)
+			return
+		}
+		accountsContent.updateView()
+	}, *window)
+}
+
+func (accountsContent *contentAccounts) showChangePassword() {
+	entryOld := widget.NewPasswordEntry()
+	entryNew := widget.NewPasswordEntry()
+	entryConfirm := widget.NewPasswordEntry()
+
+	items := []*widget.FormItem{
+		{Text: "현재 비밀번호", Widget: entryOld},
+		{Text: "새 비밀번호", Widget: entryNew},
+		{Text: "새 비밀번호 확인", Widget: entryConfirm},
+	}
+
+	dialog.ShowForm("비밀번호 변경", "변경", "취소", items, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		if entryNew.Text != entryConfirm.Text {
+			dialog.ShowInformation("비밀번호 변경", "새 비밀번호가 일치하지 않습니다.", *window)
+			return
+		}
+		if err := accounts.ChangePassword(entryOld.Text, entryNew.Text); err != nil {
+			dialog.ShowError(err, *window)
+			return
+		}
+		dialog.ShowInformation("비밀번호 변경", "비밀번호를 변경했습니다.", *window)
+	}, *window)
+}
@@ -0,0 +1,160 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"poa-manager/auth"
+	"poa-manager/event"
+	"poa-manager/manager"
+	"poa-manager/res"
+	poaUpdater "poa-manager/updater"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+type contentCompliance struct {
+	content           *fyne.Container
+	labelSummary      *widget.Label
+	buttonCheckLatest *widget.Button
+	buttonUpdate      *widget.Button
+	accordionVersions *widget.Accordion
+
+	latestVersion string
+	report        manager.ComplianceReport
+}
+
+func newComplianceContent() *contentCompliance {
+	compliance := contentCompliance{}
+
+	compliance.content = container.NewMax()
+
+	compliance.labelSummary = widget.NewLabel("")
+	compliance.buttonCheckLatest = widget.NewButton("최신 버전 확인", compliance.checkLatestVersion)
+	compliance.buttonUpdate = widget.NewButton("구버전 장치 업데이트 요청", func() {
+		outdated := compliance.report.Outdated
+		if len(outdated) == 0 {
+			return
+		}
+
+		dialog.ShowConfirm("구버전 장치 업데이트 요청", fmt.Sprintf("구버전 장치 %d 대에 업데이트를 요청하시겠습니까?", len(outdated)),
+			func(ok bool) {
+				if ok {
+					reauthenticate("구버전 장치 업데이트 요청", auth.PermissionCommand, func() {
+						deviceIds := []string{}
+						for _, device := range outdated {
+							deviceIds = append(deviceIds, device.DeviceId)
+						}
+						poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_FORCE_UPDATE_DEVICES, deviceIds)
+					})
+				}
+			}, *window)
+	})
+	compliance.accordionVersions = widget.NewAccordion()
+
+	compliance.content.Add(container.NewBorder(
+		container.NewHBox(compliance.labelSummary, layout.NewSpacer(), compliance.buttonCheckLatest, compliance.buttonUpdate),
+		nil, nil, nil, container.NewVScroll(compliance.accordionVersions)))
+
+	return &compliance
+}
+
+func (compliance *contentCompliance) GetContent() *fyne.Container {
+	return compliance.content
+}
+
+func (compliance *contentCompliance) SetMainContent() {
+	if parentContainer != nil {
+		parentContainer.Objects = []fyne.CanvasObject{compliance.content}
+		activeContect = compliance.content
+	}
+}
+
+func (compliance *contentCompliance) checkLatestVersion() {
+	address := poaContext.Configs.AgentUpdateAddress
+	if address == "" {
+		dialog.ShowInformation("최신 버전 확인", "설정에서 에이전트 업데이트 주소를 입력해 주세요.", *window)
+		return
+	}
+
+	compliance.buttonCheckLatest.Disable()
+	go func() {
+		defer compliance.buttonCheckLatest.Enable()
+
+		latestVersion, err := poaUpdater.LatestVersion(address)
+		if err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+			return
+		}
+
+		compliance.latestVersion = latestVersion
+		compliance.updateView()
+	}()
+}
+
+func (compliance *contentCompliance) updateView() {
+	compliance.report = poaManager.VersionCompliance(poaContext.Configs.RequiredAgentVersion, compliance.latestVersion)
+
+	required := compliance.report.Required
+	if required == "" {
+		required = "미설정"
+	}
+	latest := compliance.report.Latest
+	if latest == "" {
+		latest = "확인 안 됨"
+	}
+	compliance.labelSummary.SetText(fmt.Sprintf("최소 요구 버전: %s, 최신 버전: %s, 구버전 장치: %d 대", required, latest, len(compliance.report.Outdated)))
+
+	if len(compliance.report.Outdated) > 0 {
+		compliance.buttonUpdate.Enable()
+	} else {
+		compliance.buttonUpdate.Disable()
+	}
+
+	opened := map[string]bool{}
+	for _, item := range compliance.accordionVersions.Items {
+		opened[item.Title] = item.Open
+	}
+
+	items := []*widget.AccordionItem{}
+	for _, group := range compliance.report.Groups {
+		version := group.Version
+		if version == "" {
+			version = "알 수 없음"
+		}
+
+		notes := []string{}
+		if group.BelowRequired {
+			notes = append(notes, "최소 요구 버전 미만")
+		}
+		if group.BehindLatest {
+			notes = append(notes, "최신 버전 아님")
+		}
+
+		title := fmt.Sprintf("%s - %d 대", version, len(group.Devices))
+		if len(notes) > 0 {
+			title += fmt.Sprintf(" (%s)", strings.Join(notes, ", "))
+		}
+
+		devices := container.NewVBox()
+		for _, device := range group.Devices {
+			icon := widget.NewIcon(res.Ic_error)
+			if !group.Outdated() {
+				icon.Hide()
+			}
+			devices.Add(container.NewHBox(icon, widget.NewLabel(fmt.Sprintf("%s[%d]: %s (%s)", device.Owner, device.OwnNumber, device.DeviceDesc, device.DeviceId))))
+		}
+
+		item := widget.NewAccordionItem(title, devices)
+		item.Open = opened[title]
+		items = append(items, item)
+	}
+
+	compliance.accordionVersions.Items = items
+	compliance.accordionVersions.Refresh()
+}
@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"fmt"
+
+	"poa-manager/manager"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+func deviceTypeIcon(typeInfo manager.DeviceTypeInfo) fyne.Resource {
+	switch typeInfo.Icon {
+	case "computer":
+		return theme.ComputerIcon()
+	case "storage":
+		return theme.StorageIcon()
+	}
+
+	return theme.QuestionIcon()
+}
+
+func deviceTitle(device *manager.DeviceInfo) string {
+	return fmt.Sprintf("[%s] %s[%d]: %s", manager.GetDeviceType(device.DeviceType).Badge, device.Owner, device.OwnNumber, device.DeviceDesc)
+}
+
+// deviceTypeDetail returns the type name and the type specific fields for the detail panel.
+func deviceTypeDetail(device *manager.DeviceInfo) string {
+	typeInfo := manager.GetDeviceType(device.DeviceType)
+
+	text := fmt.Sprintf("장치 종류: %s", typeInfo.Name)
+	for _, field := range typeInfo.DetailFields {
+		value, ok := device.Extra[field.Key]
+		if !ok {
+			value = "-"
+		}
+		text += fmt.Sprintf("\n%s: %v", field.Label, value)
+	}
+
+	return text
+}
+
+// enableCommandButton enables the button only if the device type supports the command.
+func enableCommandButton(button *widget.Button, device *manager.DeviceInfo, commandType string) {
+	if manager.SupportsCommand(device, commandType) {
+		button.Enable()
+	} else {
+		button.Disable()
+	}
+}
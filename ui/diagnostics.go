@@ -0,0 +1,150 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"poa-manager/manager"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+const diagTimeout = time.Second * 60
+
+type diagnosticsPanel struct {
+	window fyne.Window
+	device *manager.DeviceInfo
+
+	selectKind  *widget.Select
+	targetEntry *widget.Entry
+	buttonRun   *widget.Button
+	results     *fyne.Container
+
+	requestIds []string
+}
+
+func showDiagnosticsPanel(device *manager.DeviceInfo) {
+	panel := diagnosticsPanel{device: device}
+
+	panel.window = fyne.CurrentApp().NewWindow(fmt.Sprintf("장치 진단 - %s[%d]: %s", device.Owner, device.OwnNumber, device.DeviceDesc))
+
+	names := []string{}
+	for _, descriptor := range manager.Diagnostics {
+		names = append(names, descriptor.Name)
+	}
+
+	panel.targetEntry = widget.NewEntry()
+	panel.targetEntry.SetPlaceHolder("대상 호스트 또는 IP")
+	panel.selectKind = widget.NewSelect(names, func(name string) {
+		if descriptor, ok := diagnosticByName(name); ok && descriptor.NeedsTarget {
+			panel.targetEntry.Enable()
+		} else {
+			panel.targetEntry.SetText("")
+			panel.targetEntry.Disable()
+		}
+	})
+	panel.selectKind.SetSelectedIndex(0)
+	panel.buttonRun = widget.NewButton("실행", panel.run)
+	panel.results = container.NewVBox()
+
+	toolbar := container.NewBorder(nil, nil, panel.selectKind, panel.buttonRun, panel.targetEntry)
+
+	panel.window.SetContent(container.NewBorder(toolbar, nil, nil, nil, container.NewVScroll(panel.results)))
+	panel.window.SetOnClosed(func() {
+		for _, requestId := range panel.requestIds {
+			poaManager.ReleaseDiagRun(requestId)
+		}
+	})
+	panel.window.Resize(fyne.NewSize(800, 600))
+	panel.window.Show()
+}
+
+func diagnosticByName(name string) (manager.DiagDescriptor, bool) {
+	for _, descriptor := range manager.Diagnostics {
+		if descriptor.Name == name {
+			return descriptor, true
+		}
+	}
+
+	return manager.DiagDescriptor{}, false
+}
+
+func (panel *diagnosticsPanel) run() {
+	descriptor, ok := diagnosticByName(panel.selectKind.Selected)
+	if !ok {
+		return
+	}
+	target := strings.TrimSpace(panel.targetEntry.Text)
+
+	labelHeader := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	labelResult := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	header := fmt.Sprintf("[%s] %s %s", time.Now().Format("15:04:05"), descriptor.Name, target)
+
+	// newest result on top
+	panel.results.Objects = append([]fyne.CanvasObject{container.NewVBox(labelHeader, labelResult, widget.NewSeparator())}, panel.results.Objects...)
+	panel.results.Refresh()
+
+	requestId, err := poaManager.RunDiagnostic(panel.device.DeviceId, descriptor.Kind, target)
+	if err != nil {
+		logger.LogE(err)
+		labelHeader.SetText(fmt.Sprintf("%s - 요청 실패", header))
+		labelResult.SetText(err.Error())
+		return
+	}
+	panel.requestIds = append(panel.requestIds, requestId)
+	labelHeader.SetText(fmt.Sprintf("%s - 대기 중", header))
+
+	go func() {
+		deadline := time.Now().Add(diagTimeout)
+		for time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 500)
+
+			run, ok := poaManager.GetDiagRun(requestId)
+			if !ok {
+				return
+			}
+			if !run.Received {
+				continue
+			}
+
+			if run.Result.Success {
+				labelHeader.SetText(fmt.Sprintf("%s - 성공 (%d ms)", header, run.Result.DurationMs))
+			} else {
+				labelHeader.SetText(fmt.Sprintf("%s - 실패 (%d ms)", header, run.Result.DurationMs))
+			}
+			labelResult.SetText(formatDiagResult(run.Result))
+			return
+		}
+
+		labelHeader.SetText(fmt.Sprintf("%s - 응답 시간 초과", header))
+	}()
+}
+
+func formatDiagResult(result manager.DiagResult) string {
+	lines := []string{}
+
+	keys := []string{}
+	for key := range result.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s: %s", key, result.Values[key]))
+	}
+
+	if result.Error != "" {
+		lines = append(lines, fmt.Sprintf("오류: %s", result.Error))
+	}
+	if result.Output != "" {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, strings.TrimRight(result.Output, "\n"))
+	}
+
+	return strings.Join(lines, "\n")
+}
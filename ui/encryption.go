@@ -0,0 +1,122 @@
+package ui
+
+import (
+	"fmt"
+
+	"poa-manager/auth"
+	"poa-manager/manager"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+func encryptionText(deviceId string) string {
+	keyId := poaManager.EncryptionKeyId(deviceId)
+	if keyId == "" {
+		return "페이로드 암호화: 사용 안 함"
+	}
+
+	if poaManager.DeviceKeyId(deviceId) == keyId {
+		return fmt.Sprintf("페이로드 암호화: 사용 (전용 키 %s)", keyId)
+	}
+	return fmt.Sprintf("페이로드 암호화: 사용 (공용 키 %s)", keyId)
+}
+
+// enableDeviceKeyButton enables the button for devices which already use encryption,
+// the new key is sent encrypted with the current one.
+func enableDeviceKeyButton(button *widget.Button, device *manager.DeviceInfo) {
+	if device.Alive && poaManager.EncryptionKeyId(device.DeviceId) != "" && manager.SupportsCommand(device, manager.CommandKey) {
+		button.Enable()
+	} else {
+		button.Disable()
+	}
+}
+
+func issueDeviceKey(device *manager.DeviceInfo) {
+	if !allowed(auth.PermissionKeys) {
+		return
+	}
+
+	dialog.ShowConfirm("전용 암호화 키",
+		fmt.Sprintf("%s 장치에 전용 암호화 키를 발급하여 전송하시겠습니까?\n장치가 응답하지 않으면 이전 키로 계속 통신합니다.", deviceTitle(device)),
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			if err := poaManager.DistributePayloadKey(device.DeviceId); err != nil {
+				logger.LogE(err)
+				dialog.ShowError(err, *window)
+			}
+		}, *window)
+}
+
+func (config *contentConfig) updatePayloadKey() {
+	if keyId := poaManager.FleetKeyId(); keyId != "" {
+		config.labelPayloadKey.SetText("ID: " + keyId)
+	} else {
+		config.labelPayloadKey.SetText("없음")
+	}
+}
+
+func (config *contentConfig) exportPayloadKey() {
+	if !allowed(auth.PermissionKeys) {
+		return
+	}
+
+	doc, err := poaManager.ExportPayloadKey("")
+	if err != nil {
+		logger.LogE(err)
+		dialog.ShowError(err, *window)
+		return
+	}
+
+	dialog.ShowConfirm("공용 암호화 키 내보내기", "키 파일로 장치의 모든 통신을 복호화할 수 있습니다.\n파일을 안전하게 보관해 주세요. 내보내시겠습니까?",
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil {
+					logger.LogE(err)
+					dialog.ShowError(err, *window)
+					return
+				}
+				if writer == nil {
+					return
+				}
+				defer writer.Close()
+
+				if _, err := writer.Write(doc); err != nil {
+					logger.LogE(err)
+					dialog.ShowError(err, *window)
+				}
+			}, *window)
+			saveDialog.SetFileName(fmt.Sprintf("poa_payload_%s.key", poaManager.FleetKeyId()))
+			saveDialog.Show()
+		}, *window)
+}
+
+func (config *contentConfig) rotatePayloadKey() {
+	if !allowed(auth.PermissionKeys) {
+		return
+	}
+
+	dialog.ShowConfirm("공용 암호화 키 교체",
+		"암호화를 사용하는 장치에 새 공용 키를 전송하고 교체합니다.\n이전 키는 키를 받지 못한 장치를 위해 보관됩니다. 교체하시겠습니까?",
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			reauthenticate("공용 암호화 키 교체", auth.PermissionKeys, func() {
+				if err := poaManager.DistributePayloadKey(""); err != nil {
+					logger.LogE(err)
+					dialog.ShowError(err, *window)
+				}
+				config.updatePayloadKey()
+			})
+		}, *window)
+}
@@ -0,0 +1,143 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"poa-manager/auth"
+	"poa-manager/manager"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+type contentIssues struct {
+	content      *fyne.Container
+	labelSummary *widget.Label
+	issueList    *fyne.Container
+}
+
+func newIssuesContent() *contentIssues {
+	issues := contentIssues{}
+
+	issues.content = container.NewMax()
+	issues.labelSummary = widget.NewLabel("")
+	issues.issueList = container.NewVBox()
+
+	issues.content.Add(container.NewBorder(
+		container.NewHBox(issues.labelSummary, layout.NewSpacer(), widget.NewButton("새로고침", issues.updateView)),
+		nil, nil, nil, container.NewVScroll(issues.issueList)))
+
+	return &issues
+}
+
+func (issues *contentIssues) GetContent() *fyne.Container {
+	return issues.content
+}
+
+func (issues *contentIssues) SetMainContent() {
+	if parentContainer != nil {
+		parentContainer.Objects = []fyne.CanvasObject{issues.content}
+		activeContect = issues.content
+	}
+}
+
+func issueKindText(kind manager.IssueKind) string {
+	switch kind {
+	case manager.IssueDuplicateMac:
+		return "맥주소 중복"
+	case manager.IssueDuplicateOwnNumber:
+		return "사용자/장치번호 중복"
+	case manager.IssueDuplicatePrivateIp:
+		return "내부IP 중복"
+	case manager.IssueMacChanged:
+		return "맥주소 변경"
+	}
+
+	return "알 수 없음"
+}
+
+func (issues *contentIssues) updateView() {
+	detected := poaManager.DetectIssues()
+	rejected := poaManager.GetRejectedMessages()
+
+	if len(detected) == 0 && len(rejected) == 0 {
+		issues.labelSummary.SetText("발견된 문제가 없습니다.")
+	} else {
+		issues.labelSummary.SetText(fmt.Sprintf("발견된 문제: %d 건, 잘못된 메시지를 보낸 장치: %d 대", len(detected), len(rejected)))
+	}
+
+	objects := []fyne.CanvasObject{}
+	for _, issue := range detected {
+		issue := issue
+
+		text := issue.Description
+		for _, device := range issue.Devices {
+			aliveText := "정상"
+			if !device.Alive {
+				aliveText = "응답 없음"
+			}
+			text += fmt.Sprintf("\n  %s (%s, %s, %s/%s, %s)", deviceTitle(&device), device.DeviceId, device.MacAddress,
+				device.PublicIp, device.PrivateIp, aliveText)
+		}
+		if issue.Suggestion != "" {
+			text += "\n제안: " + issue.Suggestion
+		}
+
+		actions := container.NewVBox()
+		if issue.StaleDeviceId != "" {
+			actions.Add(widget.NewButton("오래된 장치 제거", func() {
+				if !allowed(auth.PermissionRemove) {
+					return
+				}
+				dialog.ShowConfirm("중복 장치 제거", fmt.Sprintf("장치 %s 를 목록에서 제거하시겠습니까?", issue.StaleDeviceId),
+					func(ok bool) {
+						if ok {
+							// the page is refreshed when the manager reloads the device list
+							if ok, _ := poaManager.RemoveDevices(issue.StaleDeviceId); !ok {
+								dialog.ShowInformation("중복 장치 제거", "장치를 제거하지 못했습니다.", *window)
+							}
+						}
+					}, *window)
+			}))
+		}
+		if issue.MacChange != nil {
+			actions.Add(widget.NewButton("확인함", func() {
+				poaManager.DismissMacChange(issue.MacChange.DeviceId)
+				issues.updateView()
+			}))
+		}
+
+		header := widget.NewLabelWithStyle(issueKindText(issue.Kind), fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+		objects = append(objects,
+			container.NewBorder(container.NewHBox(widget.NewIcon(theme.WarningIcon()), header), nil, nil, actions, widget.NewLabel(text)),
+			widget.NewSeparator())
+	}
+
+	for _, device := range rejected {
+		device := device
+
+		text := fmt.Sprintf("장치 %s 에서 형식이 잘못된 메시지 %d 건을 받았습니다.\n마지막: %s, %s\n오류: %s\n%s",
+			device.DeviceId, device.Count, time.Unix(device.LastTime, 0).Format("2006-01-02 15:04:05"), device.LastTopic,
+			device.LastError, device.LastPayload)
+
+		header := widget.NewLabelWithStyle("잘못된 메시지", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+		label := widget.NewLabel(text)
+		label.Wrapping = fyne.TextWrapWord
+		objects = append(objects,
+			container.NewBorder(container.NewHBox(widget.NewIcon(theme.ErrorIcon()), header), nil, nil,
+				container.NewVBox(widget.NewButton("초기화", func() {
+					poaManager.ResetRejectedMessages(device.DeviceId)
+					issues.updateView()
+				})),
+				label),
+			widget.NewSeparator())
+	}
+
+	issues.issueList.Objects = objects
+	issues.issueList.Refresh()
+}
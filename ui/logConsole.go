@@ -0,0 +1,290 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"poa-manager/log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const allTagsOption = "모든 태그"
+
+// minimum level options of the log console
+var logLevelOptions = []log.Level{log.Verbose, log.Debug, log.Info, log.Warning, log.Error, log.Fatal}
+
+type contentLogConsole struct {
+	content     *fyne.Container
+	searchEntry *widget.Entry
+	selectLevel *widget.Select
+	selectTag   *widget.Select
+	checkPause  *widget.Check
+	labelCount  *widget.Label
+	listRecords *widget.List
+	labelDetail *widget.Label
+
+	logRecords *log.MemorySink
+
+	// used by the polling goroutine and the ui callbacks,
+	// the widgets are refreshed without the lock since they call back the list
+	records         []log.MemoryRecord
+	filteredRecords []log.MemoryRecord
+	lastSeq         uint64
+	paused          bool
+	mutex           *sync.Mutex
+}
+
+func newLogConsoleContent(logRecords *log.MemorySink) *contentLogConsole {
+	console := contentLogConsole{logRecords: logRecords, mutex: &sync.Mutex{}}
+
+	console.content = container.NewMax()
+
+	console.searchEntry = widget.NewEntry()
+	console.searchEntry.SetPlaceHolder("검색")
+	console.searchEntry.OnChanged = func(string) {
+		console.applyFilter()
+	}
+
+	levels := []string{}
+	for _, level := range logLevelOptions {
+		levels = append(levels, level.String())
+	}
+	console.selectLevel = widget.NewSelect(levels, func(string) {
+		console.applyFilter()
+	})
+	console.selectTag = widget.NewSelect([]string{allTagsOption}, func(string) {
+		console.applyFilter()
+	})
+	console.checkPause = widget.NewCheck("일시 정지", func(check bool) {
+		console.mutex.Lock()
+		console.paused = check
+		console.mutex.Unlock()
+	})
+	console.labelCount = widget.NewLabel("")
+
+	console.listRecords = widget.NewList(
+		func() int {
+			console.mutex.Lock()
+			defer console.mutex.Unlock()
+
+			return len(console.filteredRecords)
+		},
+		func() fyne.CanvasObject {
+			return container.NewHBox(widget.NewIcon(theme.InfoIcon()), widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			record, ok := console.filteredRecord(id)
+			if !ok {
+				return
+			}
+			item := obj.(*fyne.Container)
+			item.Objects[0].(*widget.Icon).SetResource(logLevelIcon(record.Level))
+			item.Objects[1].(*widget.Label).SetText(fmt.Sprintf("%s  %s", record.Time.Format("15:04:05.000"), firstLine(record.MessageText())))
+		})
+	console.listRecords.OnSelected = func(id widget.ListItemID) {
+		if record, ok := console.filteredRecord(id); ok {
+			console.labelDetail.SetText(formatLogRecord(&record))
+		}
+	}
+	console.labelDetail = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	console.labelDetail.Wrapping = fyne.TextWrapWord
+
+	split := container.NewVSplit(console.listRecords, container.NewScroll(console.labelDetail))
+	split.Offset = 0.75
+
+	toolbar := container.NewBorder(nil, nil, nil,
+		container.NewHBox(console.selectLevel, console.selectTag, console.checkPause,
+			widget.NewButton("지우기", console.clear), widget.NewButton("파일로 저장", console.save), console.labelCount),
+		console.searchEntry)
+
+	console.content.Add(container.NewBorder(toolbar, nil, nil, nil, split))
+
+	// the filters run on selection, select after the list is created
+	console.selectTag.SetSelected(allTagsOption)
+	console.selectLevel.SetSelected(log.Debug.String())
+
+	go func() {
+		for {
+			time.Sleep(time.Second)
+
+			if activeContect == console.content && !console.isPaused() {
+				console.updateView()
+			}
+		}
+	}()
+
+	return &console
+}
+
+func (console *contentLogConsole) GetContent() *fyne.Container {
+	return console.content
+}
+
+func (console *contentLogConsole) SetMainContent() {
+	if parentContainer != nil {
+		parentContainer.Objects = []fyne.CanvasObject{console.content}
+		activeContect = console.content
+	}
+}
+
+func logLevelIcon(level log.Level) fyne.Resource {
+	switch {
+	case level >= log.Error:
+		return theme.ErrorIcon()
+	case level == log.Warning:
+		return theme.WarningIcon()
+	}
+	return theme.InfoIcon()
+}
+
+func firstLine(text string) string {
+	if index := strings.IndexByte(text, '\n'); index >= 0 {
+		return text[:index] + " ..."
+	}
+	return text
+}
+
+func formatLogRecord(record *log.MemoryRecord) string {
+	text := fmt.Sprintf("시간: %s\n레벨: %s\n태그: %s\n\n%s",
+		record.Time.Format("2006-01-02 15:04:05.000"), record.Level, record.Tag, record.Message)
+
+	keys := make([]string, 0, len(record.Fields))
+	for key := range record.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		text += "\n"
+	}
+	for _, key := range keys {
+		text += fmt.Sprintf("\n%s: %v", key, record.Fields[key])
+	}
+
+	return text
+}
+
+func (console *contentLogConsole) isPaused() bool {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+
+	return console.paused
+}
+
+func (console *contentLogConsole) filteredRecord(id widget.ListItemID) (log.MemoryRecord, bool) {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+
+	if id < 0 || id >= len(console.filteredRecords) {
+		return log.MemoryRecord{}, false
+	}
+	return console.filteredRecords[id], true
+}
+
+func (console *contentLogConsole) updateView() {
+	console.mutex.Lock()
+	records := console.logRecords.Records(console.lastSeq)
+	if len(records) > 0 {
+		console.lastSeq = records[len(records)-1].Seq
+		console.records = append(console.records, records...)
+		if limit := poaContext.Configs.LogConsoleRecords; limit > 0 && len(console.records) > limit {
+			console.records = console.records[len(console.records)-limit:]
+		}
+	}
+	console.mutex.Unlock()
+
+	if len(records) > 0 {
+		console.applyFilter()
+		console.listRecords.ScrollToBottom()
+	}
+
+	console.updateTagOptions()
+}
+
+func (console *contentLogConsole) applyFilter() {
+	search := strings.ToLower(strings.TrimSpace(console.searchEntry.Text))
+	minLevel := logLevelOptions[0]
+	if index := console.selectLevel.SelectedIndex(); index >= 0 {
+		minLevel = logLevelOptions[index]
+	}
+	tag := ""
+	if console.selectTag.Selected != allTagsOption {
+		tag = console.selectTag.Selected
+	}
+
+	console.mutex.Lock()
+	filtered := []log.MemoryRecord{}
+	for _, record := range console.records {
+		if record.Level < minLevel {
+			continue
+		}
+		if tag != "" && record.Tag != tag {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(record.MessageText()), search) {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+
+	console.filteredRecords = filtered
+	total := len(console.records)
+	console.mutex.Unlock()
+
+	console.labelCount.SetText(fmt.Sprintf("%d / %d 건", len(filtered), total))
+	console.listRecords.Refresh()
+}
+
+func (console *contentLogConsole) updateTagOptions() {
+	console.selectTag.Options = append([]string{allTagsOption}, console.logRecords.Tags()...)
+	console.selectTag.Refresh()
+}
+
+// clear empties the console only, the records of the other sinks are kept.
+func (console *contentLogConsole) clear() {
+	console.mutex.Lock()
+	console.records = nil
+	console.mutex.Unlock()
+
+	console.listRecords.UnselectAll()
+	console.labelDetail.SetText("")
+	console.applyFilter()
+}
+
+// save writes the filtered records as the console lines.
+func (console *contentLogConsole) save() {
+	console.mutex.Lock()
+	records := console.filteredRecords
+	console.mutex.Unlock()
+
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+
+		text := strings.Builder{}
+		for i := range records {
+			text.WriteString(records[i].Text())
+			text.WriteString("\n")
+		}
+		if _, err := writer.Write([]byte(text.String())); err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+		}
+	}, *window)
+	saveDialog.SetFileName(fmt.Sprintf("poa-manager_%s.log", time.Now().Format("20060102_150405")))
+	saveDialog.Show()
+}
@@ -0,0 +1,218 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"poa-manager/manager"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	deviceLogDefaultLines = 200
+	deviceLogTimeout      = time.Second * 30
+	deviceLogTimeFormat   = "2006-01-02 15:04"
+)
+
+type logViewer struct {
+	window fyne.Window
+	device *manager.DeviceInfo
+
+	linesEntry   *numericalEntry
+	sinceEntry   *widget.Entry
+	untilEntry   *widget.Entry
+	searchEntry  *widget.Entry
+	labelLog     *widget.Label
+	labelStatus  *widget.Label
+	buttonFetch  *widget.Button
+	buttonSave   *widget.Button
+	scrollLog    *container.Scroll
+	requestId    string
+	receivedText string
+}
+
+func showDeviceLogViewer(device *manager.DeviceInfo) {
+	viewer := logViewer{device: device}
+
+	viewer.window = fyne.CurrentApp().NewWindow(fmt.Sprintf("장치 로그 - %s[%d]: %s", device.Owner, device.OwnNumber, device.DeviceDesc))
+
+	viewer.linesEntry = NewNumericalEntry()
+	viewer.linesEntry.SetText(strconv.Itoa(deviceLogDefaultLines))
+	viewer.sinceEntry = widget.NewEntry()
+	viewer.sinceEntry.SetPlaceHolder(deviceLogTimeFormat)
+	viewer.untilEntry = widget.NewEntry()
+	viewer.untilEntry.SetPlaceHolder("현재")
+	viewer.searchEntry = widget.NewEntry()
+	viewer.searchEntry.SetPlaceHolder("검색")
+	viewer.searchEntry.OnChanged = func(string) {
+		viewer.updateLogView()
+	}
+	viewer.labelLog = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	viewer.labelStatus = widget.NewLabel("")
+	viewer.buttonFetch = widget.NewButton("가져오기", viewer.fetch)
+	viewer.buttonSave = widget.NewButton("파일로 저장", viewer.save)
+	viewer.scrollLog = container.NewScroll(viewer.labelLog)
+
+	timeSize := fyne.NewSize(150, viewer.sinceEntry.MinSize().Height)
+	toolbar := container.NewBorder(nil, nil,
+		container.NewHBox(widget.NewLabel("줄 수"), container.NewGridWrap(fyne.NewSize(80, viewer.linesEntry.MinSize().Height), viewer.linesEntry),
+			widget.NewLabel("또는 기간"), container.NewGridWrap(timeSize, viewer.sinceEntry),
+			widget.NewLabel("~"), container.NewGridWrap(timeSize, viewer.untilEntry), viewer.buttonFetch),
+		viewer.buttonSave, viewer.searchEntry)
+
+	viewer.window.SetContent(container.NewBorder(toolbar, viewer.labelStatus, nil, nil, viewer.scrollLog))
+	viewer.window.SetOnClosed(func() {
+		if viewer.requestId != "" {
+			poaManager.ReleaseDeviceLog(viewer.requestId)
+		}
+	})
+	viewer.window.Resize(fyne.NewSize(960, 640))
+	viewer.window.Show()
+
+	viewer.fetch()
+}
+
+// parseLogTime parses the local time of the range entries, 0 if empty.
+func parseLogTime(text string) (int64, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+
+	t, err := time.ParseInLocation(deviceLogTimeFormat, text, time.Local)
+	if err != nil {
+		return 0, fmt.Errorf("시간 형식은 %s 입니다: %s", deviceLogTimeFormat, text)
+	}
+	return t.Unix(), nil
+}
+
+func (viewer *logViewer) fetch() {
+	lines, _ := strconv.Atoi(viewer.linesEntry.Text)
+	if lines <= 0 {
+		lines = deviceLogDefaultLines
+	}
+
+	since, err := parseLogTime(viewer.sinceEntry.Text)
+	if err != nil {
+		viewer.labelStatus.SetText(err.Error())
+		return
+	}
+	until, err := parseLogTime(viewer.untilEntry.Text)
+	if err != nil {
+		viewer.labelStatus.SetText(err.Error())
+		return
+	}
+
+	switch {
+	case since == 0 && until != 0:
+		viewer.labelStatus.SetText("기간의 시작 시간을 입력해 주세요")
+	case until != 0 && until <= since:
+		viewer.labelStatus.SetText("기간의 끝은 시작보다 늦어야 합니다")
+	case since != 0:
+		// the lines are ignored when the range is given
+		viewer.requestRange(0, since, until)
+	default:
+		viewer.requestRange(lines, 0, 0)
+	}
+}
+
+func (viewer *logViewer) requestRange(lines int, since, until int64) {
+	if viewer.requestId != "" {
+		poaManager.ReleaseDeviceLog(viewer.requestId)
+	}
+
+	requestId, err := poaManager.RequestDeviceLog(viewer.device.DeviceId, lines, since, until)
+	if err != nil {
+		logger.LogE(err)
+		viewer.labelStatus.SetText(fmt.Sprintf("요청 실패: %v", err))
+		return
+	}
+	viewer.requestId = requestId
+	viewer.buttonFetch.Disable()
+	viewer.labelStatus.SetText("로그 요청 중...")
+
+	go func() {
+		defer func() {
+			// a newer request keeps the button disabled until it ends
+			if viewer.requestId == requestId {
+				viewer.buttonFetch.Enable()
+			}
+		}()
+
+		deadline := time.Now().Add(deviceLogTimeout)
+		for time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 300)
+
+			if viewer.requestId != requestId {
+				return
+			}
+
+			deviceLog, ok := poaManager.GetDeviceLog(requestId)
+			if !ok {
+				return
+			}
+
+			if deviceLog.Error != "" {
+				viewer.labelStatus.SetText(fmt.Sprintf("장치 오류: %s", deviceLog.Error))
+				return
+			}
+			if deviceLog.Total > 0 {
+				viewer.labelStatus.SetText(fmt.Sprintf("수신 중: %d / %d", deviceLog.Received, deviceLog.Total))
+			}
+			if deviceLog.Complete {
+				viewer.receivedText = deviceLog.Text()
+				viewer.updateLogView()
+				return
+			}
+		}
+
+		viewer.labelStatus.SetText("응답 시간 초과")
+	}()
+}
+
+func (viewer *logViewer) updateLogView() {
+	lines := strings.Split(strings.TrimRight(viewer.receivedText, "\n"), "\n")
+	query := strings.ToLower(strings.TrimSpace(viewer.searchEntry.Text))
+
+	matched := []string{}
+	for _, line := range lines {
+		if query == "" || strings.Contains(strings.ToLower(line), query) {
+			matched = append(matched, line)
+		}
+	}
+
+	viewer.labelLog.SetText(strings.Join(matched, "\n"))
+	if query == "" {
+		viewer.labelStatus.SetText(fmt.Sprintf("%d 줄", len(lines)))
+	} else {
+		viewer.labelStatus.SetText(fmt.Sprintf("%d / %d 줄 일치", len(matched), len(lines)))
+	}
+	viewer.scrollLog.ScrollToBottom()
+}
+
+func (viewer *logViewer) save() {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, viewer.window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+
+		if _, err := writer.Write([]byte(viewer.receivedText)); err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, viewer.window)
+		}
+	}, viewer.window)
+	saveDialog.SetFileName(fmt.Sprintf("%s_%s.log", viewer.device.DeviceId, time.Now().Format("20060102_150405")))
+	saveDialog.Show()
+}
@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+
+	"poa-manager/auth"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+var (
+	accounts *auth.Accounts
+	onLogin  func()
+)
+
+// ShowLogin replaces the window content by the login form and calls
+// loginDone after a successful login. Without any account, the first
+// admin account is created instead.
+func ShowLogin(loginDone func()) {
+	onLogin = loginDone
+	showLogin()
+}
+
+func showLogin() {
+	entryName := widget.NewEntry()
+	entryPassword := widget.NewPasswordEntry()
+	entryConfirm := widget.NewPasswordEntry()
+	labelError := widget.NewLabel("")
+
+	firstRun := accounts.Empty()
+
+	items := []*widget.FormItem{
+		{Text: "아이디", Widget: entryName},
+		{Text: "비밀번호", Widget: entryPassword},
+	}
+	title := "로그인"
+	if firstRun {
+		items = append(items, &widget.FormItem{Text: "비밀번호 확인", Widget: entryConfirm})
+		title = "관리자 계정 만들기"
+	}
+
+	form := &widget.Form{
+		Items: items,
+		OnSubmit: func() {
+			var err error
+			if firstRun {
+				if entryPassword.Text != entryConfirm.Text {
+					labelError.SetText("비밀번호가 일치하지 않습니다.")
+					return
+				}
+				err = accounts.CreateFirstAdmin(entryName.Text, entryPassword.Text)
+			} else {
+				err = accounts.Login(entryName.Text, entryPassword.Text)
+			}
+
+			if err != nil {
+				if errors.Is(err, auth.ErrInvalidPassword) {
+					labelError.SetText("아이디 또는 비밀번호가 올바르지 않습니다.")
+				} else {
+					labelError.SetText(err.Error())
+				}
+				entryPassword.SetText("")
+				return
+			}
+
+			// the main content keeps the page of the previous operator
+			structureContent.enablePrefixSelect()
+			onLogin()
+		},
+		SubmitText: title,
+	}
+	entryPassword.OnSubmitted = func(string) {
+		if !firstRun {
+			form.OnSubmit()
+		}
+	}
+
+	header := widget.NewLabelWithStyle("PoA Manager "+title, fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+	content := container.NewVBox(header, form, labelError)
+	if firstRun {
+		content.Objects = append([]fyne.CanvasObject{widget.NewLabel("등록된 계정이 없습니다. 관리자 계정을 만들어 주세요.")}, content.Objects...)
+	}
+
+	(*window).SetContent(container.NewCenter(container.NewGridWrap(fyne.NewSize(420, content.MinSize().Height), content)))
+	(*window).Canvas().Focus(entryName)
+}
+
+// allowed shows an error dialog if the logged in operator does not have the permission.
+func allowed(permission auth.Permission) bool {
+	if err := auth.Check(permission); err != nil {
+		if errors.Is(err, auth.ErrNotLoggedIn) {
+			dialog.ShowInformation("권한 없음", "로그인이 필요합니다.", *window)
+		} else {
+			session := auth.CurrentSession()
+			dialog.ShowInformation("권한 없음", fmt.Sprintf("%s 계정(%s)은 이 작업을 할 수 없습니다.", session.Name, session.Role.Text()), *window)
+		}
+		return false
+	}
+
+	return true
+}
+
+// reauthenticate asks the password again before a fleet wide action.
+func reauthenticate(title string, permission auth.Permission, action func()) {
+	if !allowed(permission) {
+		return
+	}
+
+	entryPassword := widget.NewPasswordEntry()
+	content := container.NewVBox(widget.NewLabel("모든 장치에 영향을 주는 작업입니다.\n계속하려면 비밀번호를 다시 입력해 주세요."), entryPassword)
+
+	dialog.ShowCustomConfirm(title, "확인", "취소", content, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		if err := accounts.Reauthenticate(entryPassword.Text); err != nil {
+			dialog.ShowInformation(title, "비밀번호가 올바르지 않습니다.", *window)
+			return
+		}
+
+		action()
+	}, *window)
+}
+
+func logout() {
+	dialog.ShowConfirm("로그아웃", "로그아웃 하시겠습니까?", func(ok bool) {
+		if ok {
+			auth.Logout()
+			showLogin()
+		}
+	}, *window)
+}
@@ -2,12 +2,12 @@ package ui
 
 import (
 	"fmt"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"poa-manager/auth"
 	"poa-manager/context"
 	"poa-manager/event"
 	"poa-manager/log"
@@ -18,6 +18,8 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
@@ -48,6 +50,11 @@ var (
 	statusContent        *contentStatus
 	structureContent     *contentStructure
 	deviceControlContent *contentDeviceControl
+	complianceContent    *contentCompliance
+	issuesContent        *contentIssues
+	inspectorContent     *contentMqttInspector
+	logConsoleContent    *contentLogConsole
+	accountsContent      *contentAccounts
 	configContent        *contentConfig
 )
 
@@ -61,21 +68,42 @@ type contentStatus struct {
 	labelDetailID       *widget.Label
 	labelDetailHeader   *widget.Label
 	labelDetailData     *widget.Label
+	labelDetailPending  *widget.Label
+	buttonEditInfo      *widget.Button
+	buttonDeviceLog     *widget.Button
+	buttonDiagnostics   *widget.Button
+	buttonWake          *widget.Button
+	buttonDeviceKey     *widget.Button
 	buttonRemove        *widget.Button
+	buttonRemoveChecked *widget.Button
+	buttonRemoveStale   *widget.Button
+	buttonExport        *widget.Button
+	buttonReconcile     *widget.Button
+	labelRetention      *widget.Label
+	buttonRetention     *widget.Button
 
 	selectedDevice *manager.DeviceInfo
 	deadDeviceOnly bool
+	checkedDevices map[string]bool
 }
 
 type contentStructure struct {
-	content           *fyne.Container
-	treeDevices       *widget.Tree
-	treeData          map[string][]string
-	detailContent     *fyne.Container
-	labelDetailID     *widget.Label
-	labelDetailHeader *widget.Label
-	labelDetailData   *widget.Label
-	buttonRemove      *widget.Button
+	content            *fyne.Container
+	selectPrefix       *widget.Select
+	treeDevices        *widget.Tree
+	treeData           map[string][]string
+	networkNodes       map[string]*networkNode
+	detailContent      *fyne.Container
+	labelDetailID      *widget.Label
+	labelDetailHeader  *widget.Label
+	labelDetailData    *widget.Label
+	labelDetailPending *widget.Label
+	buttonEditInfo     *widget.Button
+	buttonDeviceLog    *widget.Button
+	buttonDiagnostics  *widget.Button
+	buttonWake         *widget.Button
+	buttonDeviceKey    *widget.Button
+	buttonRemove       *widget.Button
 
 	selectedDevice *manager.DeviceInfo
 }
@@ -86,20 +114,31 @@ type contentDeviceControl struct {
 	buttonUpdateAddress *widget.Button
 	buttonForceUpdate   *widget.Button
 	buttonForceRestart  *widget.Button
+	buttonPushConfig    *widget.Button
+	buttonConfigStatus  *widget.Button
 }
 
 type contentConfig struct {
-	content            *fyne.Container
-	serverAddressEntry *widget.Entry
-	serverPortEntry    *numericalEntry
-	mqttAddressEntry   *widget.Entry
-	mqttPortEntry      *numericalEntry
-	mqttUserEntry      *widget.Entry
-	mqttPasswordEntry  *widget.Entry
+	content               *fyne.Container
+	serverAddressEntry    *widget.Entry
+	serverPortEntry       *numericalEntry
+	mqttAddressEntry      *widget.Entry
+	mqttPortEntry         *numericalEntry
+	mqttUserEntry         *widget.Entry
+	mqttPasswordEntry     *widget.Entry
+	retentionEnabledCheck *widget.Check
+	retentionDryRunCheck  *widget.Check
+	retentionDaysEntry    *numericalEntry
+	agentUpdateEntry      *widget.Entry
+	requiredVersionEntry  *widget.Entry
+	labelSigningKey       *widget.Label
+	labelPayloadKey       *widget.Label
+	labelUnknownKeys      *widget.Label
 }
 
-func Init(_ *fyne.App, win *fyne.Window, ctx *context.Context, m *manager.Manager) {
+func Init(_ *fyne.App, win *fyne.Window, ctx *context.Context, m *manager.Manager, a *auth.Accounts, logRecords *log.MemorySink) {
 	window = win
+	accounts = a
 
 	poaContext = ctx
 	poaManager = m
@@ -107,17 +146,27 @@ func Init(_ *fyne.App, win *fyne.Window, ctx *context.Context, m *manager.Manage
 	statusContent = newStatusContent()
 	structureContent = newStructureContent()
 	deviceControlContent = newCommandDeviceControl()
+	complianceContent = newComplianceContent()
+	issuesContent = newIssuesContent()
+	inspectorContent = newMqttInspectorContent()
+	logConsoleContent = newLogConsoleContent(logRecords)
+	accountsContent = newAccountsContent()
 	configContent = newConfigContent()
 
 	menus = map[string]Menu{
 		"status":        {"전체상태", "등록된 장치들의 현재 상태를 표시합니다.", statusContent},
 		"structure":     {"네트워크별 보기", "등록된 장치들의 목록을 표시합니다.", structureContent},
 		"deviceControl": {"장치 제어", "모든 장치에게 명령 메시지를 전송합니다..", deviceControlContent},
+		"compliance":    {"버전 현황", "장치별 에이전트 버전과 업데이트 필요 여부를 표시합니다.", complianceContent},
+		"issues":        {"이상 징후", "중복되거나 식별 정보가 변경된 장치를 표시합니다.", issuesContent},
+		"inspector":     {"MQTT 모니터", "수신되는 MQTT 메시지를 표시하고 장치에 명령을 직접 전송합니다.", inspectorContent},
+		"logs":          {"로그", "매니저의 로그를 실시간으로 표시합니다.", logConsoleContent},
+		"accounts":      {"계정", "로그인 계정과 권한을 관리합니다.", accountsContent},
 		"configs":       {"설정", "매니저 환경 설정을 할 수 있습니다.", configContent},
 	}
 
 	menuIndex = map[string][]string{
-		"": {"status", "structure", "deviceControl", "configs"},
+		"": {"status", "structure", "deviceControl", "compliance", "issues", "inspector", "logs", "accounts", "configs"},
 		// "collections": {"list", "table", "tree"},
 	}
 }
@@ -155,12 +204,30 @@ func (menu *Menu) MakeMenu(parent *fyne.Container) *fyne.Container {
 					statusContent.detailContent.Hide()
 					statusContent.selectedDevice = nil
 				} else if activeContect == structureContent.content {
+					structureContent.enablePrefixSelect()
+					structureContent.selectPrefix.SetSelected(fmt.Sprintf("/%d", poaContext.Configs.SubnetPrefixLength))
 					structureContent.updateTreeView()
 					structureContent.treeDevices.OpenAllBranches()
 
 					structureContent.treeDevices.UnselectAll()
 					structureContent.detailContent.Hide()
 					structureContent.selectedDevice = nil
+				} else if activeContect == complianceContent.content {
+					complianceContent.updateView()
+				} else if activeContect == issuesContent.content {
+					issuesContent.updateView()
+				} else if activeContect == inspectorContent.content {
+					// a paused inspector keeps the shown messages
+					if !inspectorContent.isPaused() {
+						inspectorContent.updateView()
+					}
+				} else if activeContect == logConsoleContent.content {
+					// a paused console keeps the shown records
+					if !logConsoleContent.isPaused() {
+						logConsoleContent.updateView()
+					}
+				} else if activeContect == accountsContent.content {
+					accountsContent.updateView()
 				} else if activeContect == configContent.content {
 					configContent.serverAddressEntry.SetText(poaContext.Configs.PoaServerAddress)
 					configContent.serverPortEntry.SetText(strconv.FormatInt(int64(poaContext.Configs.PoaServerPort), 10))
@@ -168,6 +235,13 @@ func (menu *Menu) MakeMenu(parent *fyne.Container) *fyne.Container {
 					configContent.mqttPortEntry.SetText(strconv.FormatInt(int64(poaContext.Configs.MqttPort), 10))
 					configContent.mqttUserEntry.SetText(poaContext.Configs.MqttUser)
 					configContent.mqttPasswordEntry.SetText(poaContext.Configs.MqttPassword)
+					configContent.retentionEnabledCheck.SetChecked(poaContext.Configs.RetentionEnabled)
+					configContent.retentionDryRunCheck.SetChecked(poaContext.Configs.RetentionDryRun)
+					configContent.retentionDaysEntry.SetText(strconv.FormatInt(int64(poaContext.Configs.RetentionDays), 10))
+					configContent.agentUpdateEntry.SetText(poaContext.Configs.AgentUpdateAddress)
+					configContent.requiredVersionEntry.SetText(poaContext.Configs.RequiredAgentVersion)
+					configContent.updateSigningKey()
+					configContent.updatePayloadKey()
 				}
 			}
 		},
@@ -182,12 +256,13 @@ func RunUpdateThread() {
 			poaManager.WaitUpdated()
 
 			if activeContect == statusContent.content {
-				totalCount := len(poaManager.TotalDevices)
-				deadCount := len(poaManager.DeadDevices)
+				totalCount := len(poaManager.GetTotalDevices())
+				deadCount := len(poaManager.GetDeadDevices())
 				statusContent.labelStatus.SetText(fmt.Sprintf("전체: %d 대, 정상: %d 대, 응답 없음: %d 대", totalCount, totalCount-deadCount, deadCount))
 
 				statusContent.listDevices.Refresh()
 				statusContent.updateDetailView(statusContent.selectedDevice)
+				statusContent.updateRetentionSummary()
 
 				// status.labelOwner.SetText(fmt.Sprintf("사용자: %s", deviceInfo.Owner))
 				// status.labelOwnNumber.SetText(fmt.Sprintf("장치 번호: %d", deviceInfo.OwnNumber))
@@ -203,13 +278,17 @@ func RunUpdateThread() {
 				structureContent.treeDevices.Refresh()
 
 				structureContent.updateDetailView(structureContent.selectedDevice)
+			} else if activeContect == complianceContent.content {
+				complianceContent.updateView()
+			} else if activeContect == issuesContent.content {
+				issuesContent.updateView()
 			}
 		}
 	}()
 }
 
 func newStatusContent() *contentStatus {
-	status := contentStatus{deadDeviceOnly: false}
+	status := contentStatus{deadDeviceOnly: false, checkedDevices: map[string]bool{}}
 
 	// status.content = container.NewVBox()
 	status.content = container.NewMax()
@@ -229,47 +308,82 @@ func newStatusContent() *contentStatus {
 	})
 	status.listDevices = widget.NewList(
 		func() int {
-			if status.deadDeviceOnly {
-				return len(poaManager.DeadDevices)
-			} else {
-				return len(poaManager.TotalDevices)
-			}
+			return len(status.listedDevices())
 		},
 		func() fyne.CanvasObject {
-			return container.NewHBox(widget.NewIcon(res.Ic_error), widget.NewLabel("Template Object"), layout.NewSpacer())
+			return container.NewHBox(widget.NewCheck("", nil), widget.NewIcon(res.Ic_error), widget.NewIcon(theme.ComputerIcon()),
+				widget.NewIcon(theme.VisibilityOffIcon()), widget.NewLabel("Template Object"), layout.NewSpacer())
 		},
 		func(id widget.ListItemID, item fyne.CanvasObject) {
-			var device *manager.DeviceInfo
-
-			if status.deadDeviceOnly {
-				device = poaManager.DeadDevices[id]
-			} else {
-				device = poaManager.TotalDevices[id]
+			// the device list may be replaced since the length was read
+			devices := status.listedDevices()
+			if id >= len(devices) {
+				return
+			}
+			device := devices[id]
+
+			// list items are recycled, so detach the handler before restoring the check state
+			deviceId := device.DeviceId
+			check := item.(*fyne.Container).Objects[0].(*widget.Check)
+			check.OnChanged = nil
+			check.SetChecked(status.checkedDevices[deviceId])
+			check.OnChanged = func(checked bool) {
+				if checked {
+					status.checkedDevices[deviceId] = true
+				} else {
+					delete(status.checkedDevices, deviceId)
+				}
+				status.updateCheckedButton()
 			}
 
 			if device.Alive {
-				item.(*fyne.Container).Objects[0].Hide()
+				item.(*fyne.Container).Objects[1].Hide()
 			} else {
-				item.(*fyne.Container).Objects[0].Show()
+				item.(*fyne.Container).Objects[1].Show()
 			}
 
-			item.(*fyne.Container).Objects[1].(*widget.Label).SetText(fmt.Sprintf("%s[%d]: %s", device.Owner, device.OwnNumber, device.DeviceDesc))
+			item.(*fyne.Container).Objects[2].(*widget.Icon).SetResource(deviceTypeIcon(manager.GetDeviceType(device.DeviceType)))
+			// payload encryption indicator
+			if poaManager.EncryptionKeyId(deviceId) != "" {
+				item.(*fyne.Container).Objects[3].Show()
+			} else {
+				item.(*fyne.Container).Objects[3].Hide()
+			}
+			item.(*fyne.Container).Objects[4].(*widget.Label).SetText(deviceTitle(device))
 		})
 	status.listDevices.OnSelected = func(id widget.ListItemID) {
-		var device *manager.DeviceInfo
-
-		if status.deadDeviceOnly {
-			device = poaManager.DeadDevices[id]
-		} else {
-			device = poaManager.TotalDevices[id]
+		devices := status.listedDevices()
+		if id >= len(devices) {
+			return
 		}
+		device := devices[id]
 
 		status.selectedDevice = device
 		status.updateDetailView(device)
 		status.detailContent.Show()
 
+		status.buttonEditInfo.OnTapped = func() {
+			showEditInfoDialog(device)
+		}
+		status.buttonDeviceLog.OnTapped = func() {
+			showDeviceLogViewer(device)
+		}
+		status.buttonDiagnostics.OnTapped = func() {
+			showDiagnosticsPanel(device)
+		}
+		status.buttonWake.OnTapped = func() {
+			wakeDevice(device)
+			status.updateDetailView(device)
+		}
+		status.buttonDeviceKey.OnTapped = func() {
+			issueDeviceKey(device)
+		}
+
 		// remove device button
 		status.buttonRemove.OnTapped = func() {
+			if !allowed(auth.PermissionRemove) {
+				return
+			}
 			logger.LogD("remove device: ", device)
 			if ok, _ := poaManager.RemoveDevices(device.DeviceId); ok {
 				status.detailContent.Hide()
@@ -285,17 +399,69 @@ func newStatusContent() *contentStatus {
 	status.labelDetailID = widget.NewLabel("")
 	status.labelDetailHeader = widget.NewLabel("")
 	status.labelDetailData = widget.NewLabel("")
+	status.labelDetailPending = widget.NewLabel("")
+	status.buttonEditInfo = widget.NewButton("정보 수정", nil)
+	status.buttonDeviceLog = widget.NewButton("로그 보기", nil)
+	status.buttonDiagnostics = widget.NewButton("진단", nil)
+	status.buttonWake = widget.NewButton("깨우기", nil)
+	status.buttonDeviceKey = widget.NewButton("전용 암호화 키", nil)
 	status.buttonRemove = widget.NewButton("목록에서 제거", nil)
 
 	status.detailContent.Add(status.labelDetailID)
 	status.detailContent.Add(widget.NewSeparator())
 	status.detailContent.Add(status.labelDetailHeader)
 	status.detailContent.Add(status.labelDetailData)
+	status.detailContent.Add(status.labelDetailPending)
 	status.detailContent.Add(layout.NewSpacer())
+	status.detailContent.Add(status.buttonEditInfo)
+	status.detailContent.Add(status.buttonDeviceLog)
+	status.detailContent.Add(status.buttonDiagnostics)
+	status.detailContent.Add(status.buttonWake)
+	status.detailContent.Add(status.buttonDeviceKey)
 	status.detailContent.Add(status.buttonRemove)
 	status.detailContent.Hide()
 
-	status.content.Add(container.NewBorder(container.NewHBox(status.labelStatus, status.checkDeadDeviceOnly), nil, nil, nil,
+	status.buttonRemoveChecked = widget.NewButton("선택 장치 제거", func() {
+		ids := []string{}
+		for id := range status.checkedDevices {
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			return
+		}
+
+		dialog.ShowConfirm("선택 장치 제거", fmt.Sprintf("선택한 장치 %d 대를 목록에서 제거하시겠습니까?", len(ids)),
+			func(ok bool) {
+				if ok {
+					reauthenticate("선택 장치 제거", auth.PermissionRemove, func() {
+						removed, failed := poaManager.RemoveDeviceList(ids)
+						for _, id := range removed {
+							delete(status.checkedDevices, id)
+						}
+						status.updateCheckedButton()
+
+						status.detailContent.Hide()
+						status.listDevices.UnselectAll()
+						status.selectedDevice = nil
+
+						dialog.ShowInformation("선택 장치 제거", fmt.Sprintf("제거: %d 대, 실패: %d 대", len(removed), len(failed)), *window)
+					})
+				}
+			}, *window)
+	})
+	status.buttonRemoveChecked.Disable()
+	status.buttonRemoveStale = widget.NewButton("오래된 장치 정리", status.showRemoveStaleDialog)
+	status.buttonExport = widget.NewButton("내보내기", status.showExportDialog)
+	status.buttonReconcile = widget.NewButton("목록 대조", status.showReconcileDialog)
+
+	status.labelRetention = widget.NewLabel("")
+	status.buttonRetention = widget.NewButton("정리 내역", status.showRetentionReports)
+	status.updateRetentionSummary()
+
+	status.content.Add(container.NewBorder(
+		container.NewHBox(status.labelStatus, status.checkDeadDeviceOnly, layout.NewSpacer(),
+			status.buttonRemoveChecked, status.buttonRemoveStale, status.buttonExport, status.buttonReconcile),
+		container.NewHBox(status.labelRetention, layout.NewSpacer(), status.buttonRetention), nil, nil,
 		container.NewHSplit(status.listDevices, status.detailContent)))
 
 	// status.content.Add(container.NewVBox(status.labelOwner, status.labelOwnNumber))
@@ -322,7 +488,7 @@ func (status *contentStatus) updateDetailView(device *manager.DeviceInfo) {
 		return
 	}
 
-	device = poaManager.Devices[device.DeviceId]
+	device = poaManager.GetDevice(device.DeviceId)
 	if device == nil {
 		return
 	}
@@ -334,14 +500,226 @@ func (status *contentStatus) updateDetailView(device *manager.DeviceInfo) {
 		aliveText = "응답 없음"
 	}
 
-	status.labelDetailID.SetText(fmt.Sprintf("장치 고유번호: %s", device.DeviceId))
+	status.labelDetailID.SetText(fmt.Sprintf("장치 고유번호: %s\n%s\n%s", device.DeviceId, deviceTypeDetail(device), encryptionText(device.DeviceId)))
 	status.labelDetailHeader.SetText(fmt.Sprintf("사용자: %s\n장치번호: %d\n설명: %s", device.Owner, device.OwnNumber, device.DeviceDesc))
 	status.labelDetailData.SetText(fmt.Sprintf("공인IP: %s\n내부IP: %s\n맥주소: %s\n\n마지막 통신 시간: %s\n통신상태: %s\n\n버전:%s",
 		device.PublicIp, device.PrivateIp, device.MacAddress, time.Unix(device.Timestamp, 0).Format("2006-01-02 15:04:05"), aliveText, device.Version))
+	status.labelDetailPending.SetText(strings.TrimSpace(pendingInfoText(device.DeviceId) + "\n" + wakeRequestText(device.DeviceId)))
+
+	enableCommandButton(status.buttonEditInfo, device, manager.CommandInfo)
+	enableCommandButton(status.buttonDeviceLog, device, manager.CommandLog)
+	enableCommandButton(status.buttonDiagnostics, device, manager.CommandDiag)
+	enableDeviceKeyButton(status.buttonDeviceKey, device)
+	if device.Alive {
+		status.buttonWake.Hide()
+	} else {
+		status.buttonWake.Show()
+	}
+}
+
+func (status *contentStatus) updateCheckedButton() {
+	if len(status.checkedDevices) > 0 {
+		status.buttonRemoveChecked.SetText(fmt.Sprintf("선택 장치 제거 (%d)", len(status.checkedDevices)))
+		status.buttonRemoveChecked.Enable()
+	} else {
+		status.buttonRemoveChecked.SetText("선택 장치 제거")
+		status.buttonRemoveChecked.Disable()
+	}
+}
+
+func (status *contentStatus) showRemoveStaleDialog() {
+	entryDays := NewNumericalEntry()
+	entryDays.SetText(strconv.Itoa(poaManager.GetRetentionPolicy().Days))
+	labelPreview := widget.NewLabel("")
+
+	buttonPreview := widget.NewButton("미리보기", func() {
+		days, _ := strconv.Atoi(entryDays.Text)
+		if days <= 0 {
+			labelPreview.SetText("기간을 입력해 주세요.")
+			return
+		}
+
+		report := poaManager.PruneStaleDevices(days, true)
+		labelPreview.SetText(fmt.Sprintf("제거 대상: %d 대\n%s", len(report.Devices), formatRetentionDevices(report.Devices)))
+	})
+
+	content := container.NewBorder(
+		container.NewVBox(widget.NewLabel("지정한 기간 이상 통신이 없는 응답 없는 장치를 목록에서 제거합니다."),
+			container.NewBorder(nil, nil, widget.NewLabel("기간(일)"), buttonPreview, entryDays)),
+		nil, nil, nil, container.NewVScroll(labelPreview))
+
+	customDialog := dialog.NewCustomConfirm("오래된 장치 정리", "제거", "취소", content,
+		func(ok bool) {
+			days, _ := strconv.Atoi(entryDays.Text)
+			if ok && days > 0 {
+				reauthenticate("오래된 장치 정리", auth.PermissionRemove, func() {
+					report := poaManager.PruneStaleDevices(days, false)
+					status.updateRetentionSummary()
+
+					status.detailContent.Hide()
+					status.listDevices.UnselectAll()
+					status.selectedDevice = nil
+
+					dialog.ShowInformation("오래된 장치 정리", fmt.Sprintf("제거: %d 대, 실패: %d 대", len(report.Devices), len(report.Failed)), *window)
+				})
+			}
+		}, *window)
+	customDialog.Resize(fyne.Size{Width: 640, Height: 480})
+	customDialog.Show()
+}
+
+func (status *contentStatus) updateRetentionSummary() {
+	reports := poaManager.GetRetentionReports()
+	if len(reports) == 0 {
+		status.labelRetention.SetText("정리 내역 없음")
+		return
+	}
+
+	report := reports[len(reports)-1]
+	if report.DryRun {
+		status.labelRetention.SetText(fmt.Sprintf("최근 정리(미리보기): %s, %d 일 이상 응답 없음 %d 대 제거 예정",
+			time.Unix(report.Timestamp, 0).Format("2006-01-02 15:04:05"), report.Days, len(report.Devices)))
+	} else {
+		status.labelRetention.SetText(fmt.Sprintf("최근 정리: %s, %d 일 이상 응답 없음 %d 대 제거",
+			time.Unix(report.Timestamp, 0).Format("2006-01-02 15:04:05"), report.Days, len(report.Devices)))
+	}
+}
+
+func (status *contentStatus) showRetentionReports() {
+	reports := poaManager.GetRetentionReports()
+
+	text := ""
+	for i := len(reports) - 1; i >= 0; i-- {
+		report := reports[i]
+
+		mode := "제거"
+		if report.DryRun {
+			mode = "제거 예정"
+		}
+		text += fmt.Sprintf("[%s] %d 일 이상 응답 없음, %s: %d 대, 실패: %d 대\n%s\n",
+			time.Unix(report.Timestamp, 0).Format("2006-01-02 15:04:05"), report.Days, mode, len(report.Devices), len(report.Failed),
+			formatRetentionDevices(report.Devices))
+	}
+	if text == "" {
+		text = "정리 내역이 없습니다."
+	}
+
+	customDialog := dialog.NewCustom("정리 내역", "닫기", container.NewVScroll(widget.NewLabel(text)), *window)
+	customDialog.Resize(fyne.Size{Width: 640, Height: 480})
+	customDialog.Show()
+}
+
+func formatRetentionDevices(devices []manager.DeviceInfo) (text string) {
+	for _, device := range devices {
+		text += fmt.Sprintf("  %s[%d]: %s (%s, 마지막 통신 시간: %s)\n", device.Owner, device.OwnNumber, device.DeviceDesc,
+			device.DeviceId, time.Unix(device.Timestamp, 0).Format("2006-01-02 15:04:05"))
+	}
+
+	return
+}
+
+// listedDevices returns the devices shown with the current filter
+func (status *contentStatus) listedDevices() []*manager.DeviceInfo {
+	if status.deadDeviceOnly {
+		return poaManager.GetDeadDevices()
+	}
+	return poaManager.GetTotalDevices()
+}
+
+func (status *contentStatus) showExportDialog() {
+	devices := status.listedDevices()
+
+	formats := []string{}
+	for _, format := range manager.ExportFormats {
+		formats = append(formats, string(format))
+	}
+	selectFormat := widget.NewSelect(formats, nil)
+	selectFormat.SetSelected(formats[0])
+
+	content := container.NewVBox(widget.NewLabel(fmt.Sprintf("현재 목록의 장치 %d 대를 내보냅니다.", len(devices))), selectFormat)
+
+	dialog.ShowCustomConfirm("장치 목록 내보내기", "저장", "취소", content,
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			format := manager.ExportFormat(selectFormat.Selected)
+			saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil {
+					logger.LogE(err)
+					dialog.ShowError(err, *window)
+					return
+				}
+				if writer == nil {
+					return
+				}
+				defer writer.Close()
+
+				if err := manager.ExportDevices(writer, format, devices); err != nil {
+					logger.LogE(err)
+					dialog.ShowError(err, *window)
+				}
+			}, *window)
+			saveDialog.SetFileName(fmt.Sprintf("devices_%s.%s", time.Now().Format("20060102_150405"), format))
+			saveDialog.Show()
+		}, *window)
+}
+
+func (status *contentStatus) showReconcileDialog() {
+	openDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		expectedDevices, err := manager.ParseExpectedDevices(reader)
+		if err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+			return
+		}
+
+		report := manager.ReconcileDevices(expectedDevices, poaManager.GetTotalDevices())
+
+		text := fmt.Sprintf("예상 장치: %d 대, 일치: %d 대, 누락: %d 대, 예상 외: %d 대, 정보 불일치: %d 대\n",
+			len(expectedDevices), report.Matched, len(report.Missing), len(report.Unexpected), len(report.Mismatched))
+
+		if len(report.Missing) > 0 {
+			text += "\n[누락 - 등록되지 않은 장치]\n"
+			for _, expected := range report.Missing {
+				text += fmt.Sprintf("  %s[%d] %s %s\n", expected.Owner, expected.OwnNumber, expected.DeviceId, expected.MacAddress)
+			}
+		}
+		if len(report.Unexpected) > 0 {
+			text += "\n[예상 외 - 목록에 없는 장치]\n"
+			for _, device := range report.Unexpected {
+				text += fmt.Sprintf("  %s[%d]: %s (%s, %s)\n", device.Owner, device.OwnNumber, device.DeviceDesc, device.DeviceId, device.MacAddress)
+			}
+		}
+		if len(report.Mismatched) > 0 {
+			text += "\n[정보 불일치]\n"
+			for _, mismatch := range report.Mismatched {
+				text += fmt.Sprintf("  %s: 예상 %s[%d], 등록 %s[%d]\n", mismatch.Device.DeviceId,
+					mismatch.Expected.Owner, mismatch.Expected.OwnNumber, mismatch.Device.Owner, mismatch.Device.OwnNumber)
+			}
+		}
+
+		customDialog := dialog.NewCustom("목록 대조 결과", "닫기", container.NewVScroll(widget.NewLabel(text)), *window)
+		customDialog.Resize(fyne.Size{Width: 720, Height: 480})
+		customDialog.Show()
+	}, *window)
+	openDialog.SetFilter(storage.NewExtensionFileFilter([]string{".csv"}))
+	openDialog.Show()
 }
 
 func newStructureContent() *contentStructure {
-	structure := contentStructure{treeData: map[string][]string{}}
+	structure := contentStructure{treeData: map[string][]string{}, networkNodes: map[string]*networkNode{}}
 
 	structure.content = container.NewMax()
 	structure.treeDevices = &widget.Tree{
@@ -356,25 +734,37 @@ func newStructureContent() *contentStructure {
 		CreateNode: func(branch bool) fyne.CanvasObject {
 			label := widget.NewLabel("Template Object")
 			label.Resize(fyne.Size{Height: 200})
-			return container.NewHBox(widget.NewIcon(res.Ic_error), label)
+			return container.NewHBox(widget.NewIcon(res.Ic_error), widget.NewIcon(theme.ComputerIcon()), label)
 		},
 		UpdateNode: func(uid string, branch bool, node fyne.CanvasObject) {
 			// node.(*widget.Label).SetText(uid)
-			if branch {
-				node.(*fyne.Container).Objects[0].(*widget.Icon).Hide()
-			}
-
-			if match, _ := regexp.MatchString("[0-9]+\\.[0-9]+\\.[0-9]+\\.[0-9]", uid); match {
-				node.(*fyne.Container).Objects[1].(*widget.Label).SetText(uid)
+			if network, ok := structure.networkNodes[uid]; ok {
+				node.(*fyne.Container).Objects[0].(*widget.Icon).SetResource(network.statusIcon())
+				node.(*fyne.Container).Objects[0].(*widget.Icon).Show()
+				node.(*fyne.Container).Objects[1].(*widget.Icon).Hide()
+				node.(*fyne.Container).Objects[2].(*widget.Label).SetText(fmt.Sprintf("%s (정상: %d, 응답 없음: %d)", network.label, network.alive, network.dead))
 			} else {
 				// device.DeviceId, owner, device.OwnNumber, desc
 				nodeInfos := strings.Split(uid, " \\ ")
 				owner := strings.ReplaceAll(nodeInfos[1], "\\\\", "\\")
 				ownNumber := nodeInfos[2]
 				desc := strings.ReplaceAll(nodeInfos[3], "\\\\", "\\")
-				node.(*fyne.Container).Objects[1].(*widget.Label).SetText(fmt.Sprintf("%s[%s]: %s", owner, ownNumber, desc))
+				device := poaManager.GetDevice(nodeInfos[0])
+				// the device is removed since the tree was built
+				if device == nil {
+					node.(*fyne.Container).Objects[0].(*widget.Icon).Hide()
+					node.(*fyne.Container).Objects[1].(*widget.Icon).Hide()
+					node.(*fyne.Container).Objects[2].(*widget.Label).SetText(fmt.Sprintf("%s[%s]: %s", owner, ownNumber, desc))
+					return
+				}
+				typeInfo := manager.GetDeviceType(device.DeviceType)
+
+				node.(*fyne.Container).Objects[0].(*widget.Icon).SetResource(res.Ic_error)
+				node.(*fyne.Container).Objects[1].(*widget.Icon).SetResource(deviceTypeIcon(typeInfo))
+				node.(*fyne.Container).Objects[1].(*widget.Icon).Show()
+				node.(*fyne.Container).Objects[2].(*widget.Label).SetText(fmt.Sprintf("[%s] %s[%s]: %s", typeInfo.Badge, owner, ownNumber, desc))
 
-				if poaManager.Devices[nodeInfos[0]].Alive {
+				if device.Alive {
 					node.(*fyne.Container).Objects[0].(*widget.Icon).Hide()
 					// node.(*fyne.Container).Objects[0].(*widget.Icon).SetResource(res.Ic_connected)
 				} else {
@@ -389,34 +779,63 @@ func newStructureContent() *contentStructure {
 	structure.treeDevices.OnSelected = func(uid string) {
 		logger.LogD("Tree node selected:", uid)
 
-		if match, _ := regexp.MatchString("[0-9]+\\.[0-9]+\\.[0-9]+\\.[0-9]", uid); match {
+		if _, ok := structure.networkNodes[uid]; ok {
 			structure.detailContent.Hide()
 			structure.selectedDevice = nil
 		} else {
 			// nodeInfos: device.DeviceId \ owner \ device.OwnNumber \ desc
 			nodeInfos := strings.Split(uid, " \\ ")
 			deviceId := nodeInfos[0]
-			device := poaManager.Devices[deviceId]
+			device := poaManager.GetDevice(deviceId)
+			if device == nil {
+				structure.detailContent.Hide()
+				structure.selectedDevice = nil
+				return
+			}
 
 			structure.selectedDevice = device
 
 			structure.detailContent.Show()
 			structure.updateDetailView(device)
 
+			structure.buttonEditInfo.OnTapped = func() {
+				showEditInfoDialog(device)
+			}
+			structure.buttonDeviceLog.OnTapped = func() {
+				showDeviceLogViewer(device)
+			}
+			structure.buttonDiagnostics.OnTapped = func() {
+				showDiagnosticsPanel(device)
+			}
+			structure.buttonDeviceKey.OnTapped = func() {
+				issueDeviceKey(device)
+			}
+			structure.buttonWake.OnTapped = func() {
+				wakeDevice(device)
+				structure.updateDetailView(device)
+			}
+
 			// remove device button
 			structure.buttonRemove.OnTapped = func() {
+				if !allowed(auth.PermissionRemove) {
+					return
+				}
 				logger.LogD("remove device: ", device)
 				if ok, _ := poaManager.RemoveDevices(deviceId); ok {
-					treeDeviceItems := structure.treeData[device.PublicIp]
-					structure.treeData[device.PublicIp] = []string{}
+					for parent, treeDeviceItems := range structure.treeData {
+						if _, ok := structure.networkNodes[parent]; !ok {
+							continue
+						}
 
-					for _, treeDeviceItem := range treeDeviceItems {
-						nodeInfos := strings.Split(treeDeviceItem, " \\ ")
-						if len(nodeInfos) > 0 {
-							treeNodeId := nodeInfos[0]
+						structure.treeData[parent] = []string{}
+						for _, treeDeviceItem := range treeDeviceItems {
+							nodeInfos := strings.Split(treeDeviceItem, " \\ ")
+							if len(nodeInfos) > 0 {
+								treeNodeId := nodeInfos[0]
 
-							if treeNodeId != device.DeviceId {
-								structure.treeData[device.PublicIp] = append(structure.treeData[device.PublicIp], treeDeviceItem)
+								if treeNodeId != device.DeviceId {
+									structure.treeData[parent] = append(structure.treeData[parent], treeDeviceItem)
+								}
 							}
 						}
 					}
@@ -439,6 +858,12 @@ func newStructureContent() *contentStructure {
 	structure.labelDetailID = widget.NewLabel("")
 	structure.labelDetailHeader = widget.NewLabel("")
 	structure.labelDetailData = widget.NewLabel("")
+	structure.labelDetailPending = widget.NewLabel("")
+	structure.buttonEditInfo = widget.NewButton("정보 수정", nil)
+	structure.buttonDeviceLog = widget.NewButton("로그 보기", nil)
+	structure.buttonDiagnostics = widget.NewButton("진단", nil)
+	structure.buttonWake = widget.NewButton("깨우기", nil)
+	structure.buttonDeviceKey = widget.NewButton("전용 암호화 키", nil)
 	structure.buttonRemove = widget.NewButton("목록에서 제거", nil)
 
 	structure.detailContent.Add(structure.labelDetailID)
@@ -446,10 +871,39 @@ func newStructureContent() *contentStructure {
 	structure.detailContent.Add(structure.labelDetailHeader)
 	// structure.detailContent.Add(widget.NewSeparator())
 	structure.detailContent.Add(structure.labelDetailData)
+	structure.detailContent.Add(structure.labelDetailPending)
 	structure.detailContent.Add(layout.NewSpacer())
+	structure.detailContent.Add(structure.buttonEditInfo)
+	structure.detailContent.Add(structure.buttonDeviceLog)
+	structure.detailContent.Add(structure.buttonDiagnostics)
+	structure.detailContent.Add(structure.buttonWake)
+	structure.detailContent.Add(structure.buttonDeviceKey)
 	structure.detailContent.Add(structure.buttonRemove)
 
-	structure.content.Add(container.NewHSplit(container.NewBorder(nil, nil, nil, nil, structure.treeDevices), structure.detailContent))
+	prefixes := []string{}
+	for prefix := 16; prefix <= 30; prefix++ {
+		prefixes = append(prefixes, fmt.Sprintf("/%d", prefix))
+	}
+	structure.selectPrefix = widget.NewSelect(prefixes, func(selected string) {
+		prefix, _ := strconv.Atoi(strings.TrimPrefix(selected, "/"))
+		if prefix != poaContext.Configs.SubnetPrefixLength {
+			if !allowed(auth.PermissionConfig) {
+				structure.selectPrefix.SetSelected(fmt.Sprintf("/%d", poaContext.Configs.SubnetPrefixLength))
+				return
+			}
+
+			poaContext.Configs.SubnetPrefixLength = prefix
+			writeConfig("SubnetPrefixLength")
+		}
+
+		structure.updateTreeView()
+		structure.treeDevices.Refresh()
+		structure.treeDevices.OpenAllBranches()
+	})
+
+	structure.content.Add(container.NewHSplit(
+		container.NewBorder(container.NewHBox(widget.NewLabel("내부 서브넷 크기"), structure.selectPrefix), nil, nil, nil, structure.treeDevices),
+		structure.detailContent))
 
 	// status.content.Add(container.NewVBox(status.labelOwner, status.labelOwnNumber))
 	// status.content.Add(status.labelDesc)
@@ -470,6 +924,15 @@ func (structure *contentStructure) SetMainContent() {
 	}
 }
 
+// enablePrefixSelect disables the subnet size for operators who may not change the configs.
+func (structure *contentStructure) enablePrefixSelect() {
+	if auth.Check(auth.PermissionConfig) == nil {
+		structure.selectPrefix.Enable()
+	} else {
+		structure.selectPrefix.Disable()
+	}
+}
+
 func (structure *contentStructure) makeUid(device *manager.DeviceInfo) (uid string) {
 	owner := strings.ReplaceAll(device.Owner, "\\", "\\\\")
 	desc := strings.ReplaceAll(device.DeviceDesc, "\\", "\\\\")
@@ -478,37 +941,81 @@ func (structure *contentStructure) makeUid(device *manager.DeviceInfo) (uid stri
 	return
 }
 
+// updateTreeView groups the devices by public ip, then by the private subnet
+// derived from the private ip with the configured prefix length.
 func (structure *contentStructure) updateTreeView() {
 	structure.treeData = map[string][]string{}
+	structure.networkNodes = map[string]*networkNode{}
 
-	publicIps := map[string]manager.DeviceInfo{}
-	for _, device := range poaManager.TotalDevices {
-		publicIps[device.PublicIp] = *device
-	}
+	prefixLength := poaContext.Configs.SubnetPrefixLength
 
 	roots := []string{}
-	for publicIp := range publicIps {
-		roots = append(roots, publicIp)
+	for _, device := range poaManager.GetTotalDevices() {
+		publicIp := device.PublicIp
+		if publicIp == "" {
+			publicIp = "알 수 없음"
+		}
+		subnet := manager.PrivateSubnet(device.PrivateIp, prefixLength)
+		if subnet == "" {
+			subnet = "알 수 없음"
+		}
+		subnetUid := fmt.Sprintf("%s - %s", publicIp, subnet)
 
-		for _, device := range poaManager.TotalDevices {
-			if publicIp == device.PublicIp {
-				structure.treeData[publicIp] = append(structure.treeData[publicIp], structure.makeUid(device))
-			}
+		publicNode, ok := structure.networkNodes[publicIp]
+		if !ok {
+			publicNode = &networkNode{label: publicIp}
+			structure.networkNodes[publicIp] = publicNode
+			roots = append(roots, publicIp)
 		}
+		subnetNode, ok := structure.networkNodes[subnetUid]
+		if !ok {
+			subnetNode = &networkNode{label: subnet}
+			structure.networkNodes[subnetUid] = subnetNode
+			structure.treeData[publicIp] = append(structure.treeData[publicIp], subnetUid)
+		}
+
+		publicNode.count(device)
+		subnetNode.count(device)
+		structure.treeData[subnetUid] = append(structure.treeData[subnetUid], structure.makeUid(device))
 	}
 
-	sort.Slice(roots, func(i, j int) bool {
-		return roots[i] < roots[j]
-	})
+	for _, subnets := range structure.treeData {
+		sort.Strings(subnets)
+	}
+	sort.Strings(roots)
 	structure.treeData[""] = roots
 }
 
+type networkNode struct {
+	label string
+	alive int
+	dead  int
+}
+
+func (network *networkNode) count(device *manager.DeviceInfo) {
+	if device.Alive {
+		network.alive++
+	} else {
+		network.dead++
+	}
+}
+
+// statusIcon returns the aggregated status of the devices under the node
+func (network *networkNode) statusIcon() fyne.Resource {
+	if network.dead == 0 {
+		return res.Ic_connected
+	} else if network.alive == 0 {
+		return res.Ic_error
+	}
+	return theme.WarningIcon()
+}
+
 func (structure *contentStructure) updateDetailView(device *manager.DeviceInfo) {
 	if device == nil {
 		return
 	}
 
-	device = poaManager.Devices[device.DeviceId]
+	device = poaManager.GetDevice(device.DeviceId)
 	if device == nil {
 		return
 	}
@@ -520,14 +1027,99 @@ func (structure *contentStructure) updateDetailView(device *manager.DeviceInfo)
 		aliveText = "응답 없음"
 	}
 
-	structure.labelDetailID.SetText(fmt.Sprintf("장치 고유번호: %s", device.DeviceId))
+	structure.labelDetailID.SetText(fmt.Sprintf("장치 고유번호: %s\n%s\n%s", device.DeviceId, deviceTypeDetail(device), encryptionText(device.DeviceId)))
 	structure.labelDetailHeader.SetText(fmt.Sprintf("사용자: %s\n장치번호: %d\n설명: %s", device.Owner, device.OwnNumber, device.DeviceDesc))
 	structure.labelDetailData.SetText(fmt.Sprintf("공인IP: %s\n내부IP: %s\n맥주소: %s\n\n마지막 통신 시간: %s\n통신상태: %s\n\n버전:%s",
 		device.PublicIp, device.PrivateIp, device.MacAddress, time.Unix(device.Timestamp, 0).Format("2006-01-02 15:04:04"), aliveText, device.Version))
+	structure.labelDetailPending.SetText(strings.TrimSpace(pendingInfoText(device.DeviceId) + "\n" + wakeRequestText(device.DeviceId)))
+
+	enableCommandButton(structure.buttonEditInfo, device, manager.CommandInfo)
+	enableCommandButton(structure.buttonDeviceLog, device, manager.CommandLog)
+	enableCommandButton(structure.buttonDiagnostics, device, manager.CommandDiag)
+	enableDeviceKeyButton(structure.buttonDeviceKey, device)
+	if device.Alive {
+		structure.buttonWake.Hide()
+	} else {
+		structure.buttonWake.Show()
+	}
 
 	structure.treeDevices.Select(structure.makeUid(device))
 }
 
+func showEditInfoDialog(device *manager.DeviceInfo) {
+	if !allowed(auth.PermissionCommand) {
+		return
+	}
+
+	entryOwner := widget.NewEntry()
+	entryOwner.SetText(device.Owner)
+	entryOwnNumber := NewNumericalEntry()
+	entryOwnNumber.SetText(strconv.Itoa(device.OwnNumber))
+	entryDesc := widget.NewEntry()
+	entryDesc.SetText(device.DeviceDesc)
+
+	items := []*widget.FormItem{
+		{Text: "사용자", Widget: entryOwner},
+		{Text: "장치번호", Widget: entryOwnNumber},
+		{Text: "설명", Widget: entryDesc},
+	}
+
+	formDialog := dialog.NewForm("장치 정보 수정", "확인", "취소", items,
+		func(ok bool) {
+			if ok {
+				ownNumber, err := strconv.Atoi(entryOwnNumber.Text)
+				if err != nil {
+					dialog.ShowInformation("장치 정보 수정", "장치번호는 숫자로 입력해 주세요.", *window)
+					return
+				}
+
+				poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_CHANGE_INFO, device.DeviceId, entryOwner.Text, ownNumber, entryDesc.Text)
+			}
+		}, *window)
+	formDialog.Resize(fyne.Size{Width: 480})
+	formDialog.Show()
+}
+
+func pendingInfoText(deviceId string) string {
+	pending, ok := poaManager.GetPendingInfo(deviceId)
+	if !ok {
+		return ""
+	}
+
+	if pending.Confirmed {
+		return fmt.Sprintf("정보 변경 확인됨: %s", time.Unix(pending.ConfirmTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	return fmt.Sprintf("정보 변경 요청 중: %s[%d]: %s (%s)", pending.Info.Owner, pending.Info.OwnNumber, pending.Info.DeviceDesc,
+		time.Unix(pending.RequestTime, 0).Format("2006-01-02 15:04:05"))
+}
+
+func wakeDevice(device *manager.DeviceInfo) {
+	if !allowed(auth.PermissionCommand) {
+		return
+	}
+
+	peer, err := poaManager.WakeDevice(device.DeviceId, poaContext.Configs.SubnetPrefixLength)
+	if err != nil {
+		logger.LogE(err)
+		dialog.ShowInformation("장치 깨우기", fmt.Sprintf("깨우기 요청을 보내지 못했습니다.\n%v", err), *window)
+		return
+	}
+
+	dialog.ShowInformation("장치 깨우기", fmt.Sprintf("%s (%s) 장치를 통해 깨우기를 요청했습니다.", deviceTitle(peer), peer.PrivateIp), *window)
+}
+
+func wakeRequestText(deviceId string) string {
+	request, ok := poaManager.GetWakeRequest(deviceId)
+	if !ok {
+		return ""
+	}
+
+	if request.Woken {
+		return fmt.Sprintf("깨우기 성공: %s", time.Unix(request.WokenTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	return fmt.Sprintf("깨우기 요청 중: %s (%s)", request.PeerId, time.Unix(request.RequestTime, 0).Format("2006-01-02 15:04:05"))
+}
+
 func newCommandDeviceControl() *contentDeviceControl {
 	deviceControl := contentDeviceControl{}
 
@@ -545,7 +1137,9 @@ func newCommandDeviceControl() *contentDeviceControl {
 		dialog.ShowCustomConfirm("MQTT 계정 정보 변경", "확인", "취소", content,
 			func(ok bool) {
 				if ok && entryUser.Text != "" && entryPassword.Text != "" {
-					poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_MQTT_CHANGE_USER_PASSWORD, entryUser.Text, entryPassword.Text)
+					reauthenticate("MQTT 계정 정보 변경", auth.PermissionCommand, func() {
+						poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_MQTT_CHANGE_USER_PASSWORD, entryUser.Text, entryPassword.Text)
+					})
 				}
 			}, *window)
 	})
@@ -560,7 +1154,9 @@ func newCommandDeviceControl() *contentDeviceControl {
 		customDialog := dialog.NewCustomConfirm("업데이트 주소 설정", "확인", "취소", content,
 			func(ok bool) {
 				if ok && entryServerAddress.Text != "" {
-					poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_CHANGE_UPDATE_ADDRESS, entryServerAddress.Text)
+					reauthenticate("업데이트 주소 설정", auth.PermissionCommand, func() {
+						poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_CHANGE_UPDATE_ADDRESS, entryServerAddress.Text)
+					})
 				}
 			}, *window)
 		customDialog.Resize(fyne.Size{Width: 640})
@@ -568,8 +1164,10 @@ func newCommandDeviceControl() *contentDeviceControl {
 	})
 
 	deviceControl.buttonForceUpdate = widget.NewButton("업데이트 확인 요청", func() {
-		poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_FORCE_UPDATE)
-		dialog.ShowInformation("업데이트 확인 요청", "업데이트 확인을 요청했습니다.", *window)
+		reauthenticate("업데이트 확인 요청", auth.PermissionCommand, func() {
+			poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_FORCE_UPDATE)
+			dialog.ShowInformation("업데이트 확인 요청", "업데이트 확인을 요청했습니다.", *window)
+		})
 	})
 
 	deviceControl.buttonForceRestart = widget.NewButton("어플리케이션 재시작", func() {
@@ -580,16 +1178,144 @@ func newCommandDeviceControl() *contentDeviceControl {
 		dialog.ShowCustomConfirm("어플리케이션 재시작 요청", "확인", "취소", content,
 			func(ok bool) {
 				if ok {
-					poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_RESTART)
+					reauthenticate("어플리케이션 재시작 요청", auth.PermissionCommand, func() {
+						poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_RESTART)
+					})
 				}
 			}, *window)
 	})
 
-	deviceControl.content.Add(container.NewHBox(layout.NewSpacer(), container.NewVBox(deviceControl.buttonMqttUserPwd, deviceControl.buttonUpdateAddress, deviceControl.buttonForceUpdate, deviceControl.buttonForceRestart), layout.NewSpacer()))
+	deviceControl.buttonPushConfig = widget.NewButton("장치 설정 배포", showPushConfigDialog)
+	deviceControl.buttonConfigStatus = widget.NewButton("설정 배포 현황", showConfigPushStatus)
+
+	deviceControl.content.Add(container.NewHBox(layout.NewSpacer(), container.NewVBox(deviceControl.buttonMqttUserPwd, deviceControl.buttonUpdateAddress, deviceControl.buttonForceUpdate, deviceControl.buttonForceRestart,
+		deviceControl.buttonPushConfig, deviceControl.buttonConfigStatus), layout.NewSpacer()))
 
 	return &deviceControl
 }
 
+// showPushConfigDialog builds the config form from manager.ConfigSchema.
+// Only the keys checked with "적용" are sent.
+func showPushConfigDialog() {
+	type configField struct {
+		key   manager.ConfigKey
+		apply *widget.Check
+		value func() (interface{}, error)
+	}
+
+	fields := []configField{}
+	items := []*widget.FormItem{}
+
+	for _, key := range manager.ConfigSchema {
+		key := key
+		field := configField{key: key, apply: widget.NewCheck("적용", nil)}
+
+		var input fyne.CanvasObject
+		switch key.Type {
+		case manager.ConfigTypeBool:
+			check := widget.NewCheck("사용", nil)
+			field.value = func() (interface{}, error) {
+				return check.Checked, nil
+			}
+			input = check
+		case manager.ConfigTypeInt:
+			entry := NewNumericalEntry()
+			entry.SetPlaceHolder(fmt.Sprintf("%d ~ %d", key.Min, key.Max))
+			field.value = func() (interface{}, error) {
+				number, err := strconv.Atoi(entry.Text)
+				if err != nil {
+					return nil, fmt.Errorf("%s: integer value required", key.Name)
+				}
+				return number, nil
+			}
+			input = entry
+		case manager.ConfigTypeEnum:
+			selectOption := widget.NewSelect(key.Options, nil)
+			field.value = func() (interface{}, error) {
+				return selectOption.Selected, nil
+			}
+			input = selectOption
+		default:
+			entry := widget.NewEntry()
+			field.value = func() (interface{}, error) {
+				return entry.Text, nil
+			}
+			input = entry
+		}
+
+		fields = append(fields, field)
+		items = append(items, &widget.FormItem{Text: key.Name, Widget: container.NewBorder(nil, nil, field.apply, nil, input), HintText: key.Description})
+	}
+
+	formDialog := dialog.NewForm("장치 설정 배포", "배포", "취소", items,
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			values := map[string]interface{}{}
+			for _, field := range fields {
+				if !field.apply.Checked {
+					continue
+				}
+
+				value, err := field.value()
+				if err != nil {
+					dialog.ShowError(err, *window)
+					return
+				}
+				values[field.key.Name] = value
+			}
+
+			if err := manager.ValidateConfig(values); err != nil {
+				dialog.ShowError(err, *window)
+				return
+			}
+
+			reauthenticate("장치 설정 배포", auth.PermissionCommand, func() {
+				poaContext.EventLooper.PushEvent(event.MANAGER, event.EVENT_MANAGER_DEVICE_PUSH_CONFIG, values, []string{})
+				dialog.ShowInformation("장치 설정 배포", "정상 장치에 설정을 배포했습니다.", *window)
+			})
+		}, *window)
+	formDialog.Resize(fyne.Size{Width: 640})
+	formDialog.Show()
+}
+
+func showConfigPushStatus() {
+	text := ""
+	for _, status := range poaManager.GetConfigPushStatus() {
+		keys := []string{}
+		for key := range status.Config.Values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		values := []string{}
+		for _, key := range keys {
+			values = append(values, fmt.Sprintf("%s=%v", key, status.Config.Values[key]))
+		}
+
+		text += fmt.Sprintf("[%s] 리비전 %d\n  %s\n  적용: %d 대, 미적용: %d 대\n",
+			time.Unix(status.Timestamp, 0).Format("2006-01-02 15:04:05"), status.Config.Revision, strings.Join(values, ", "),
+			len(status.Applied), len(status.Pending))
+
+		for _, deviceId := range status.Pending {
+			if device := poaManager.GetDevice(deviceId); device != nil {
+				text += fmt.Sprintf("    미적용 %s[%d]: %s (%s)\n", device.Owner, device.OwnNumber, device.DeviceDesc, deviceId)
+			} else {
+				text += fmt.Sprintf("    미적용 %s\n", deviceId)
+			}
+		}
+	}
+	if text == "" {
+		text = "배포한 설정이 없습니다."
+	}
+
+	customDialog := dialog.NewCustom("설정 배포 현황", "닫기", container.NewVScroll(widget.NewLabel(text)), *window)
+	customDialog.Resize(fyne.Size{Width: 640, Height: 480})
+	customDialog.Show()
+}
+
 func (deviceControl *contentDeviceControl) GetContent() *fyne.Container {
 	return deviceControl.content
 }
@@ -612,6 +1338,13 @@ func newConfigContent() *contentConfig {
 	config.mqttPortEntry = NewNumericalEntry()
 	config.mqttUserEntry = widget.NewEntry()
 	config.mqttPasswordEntry = widget.NewPasswordEntry()
+	config.retentionEnabledCheck = widget.NewCheck("오래된 응답 없는 장치 자동 제거", nil)
+	config.retentionDryRunCheck = widget.NewCheck("미리보기만 (실제로 제거하지 않음)", nil)
+	config.retentionDaysEntry = NewNumericalEntry()
+	config.agentUpdateEntry = widget.NewEntry()
+	config.agentUpdateEntry.SetPlaceHolder("github.com/<owner>/<repository>")
+	config.requiredVersionEntry = widget.NewEntry()
+	config.requiredVersionEntry.SetPlaceHolder("v0.0.0")
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
@@ -621,8 +1354,17 @@ func newConfigContent() *contentConfig {
 			{Text: "MQTT 포트", Widget: config.mqttPortEntry},
 			{Text: "MQTT 사용자", Widget: config.mqttUserEntry},
 			{Text: "MQTT 패스워드", Widget: config.mqttPasswordEntry},
+			{Text: "자동 정리", Widget: config.retentionEnabledCheck},
+			{Text: "", Widget: config.retentionDryRunCheck},
+			{Text: "정리 기간(일)", Widget: config.retentionDaysEntry},
+			{Text: "에이전트 업데이트 주소", Widget: config.agentUpdateEntry},
+			{Text: "최소 요구 버전", Widget: config.requiredVersionEntry},
 		},
 		OnSubmit: func() {
+			if !allowed(auth.PermissionConfig) {
+				return
+			}
+
 			oldConfigs := poaContext.Configs
 
 			poaContext.Configs.PoaServerAddress = config.serverAddressEntry.Text
@@ -631,20 +1373,153 @@ func newConfigContent() *contentConfig {
 			poaContext.Configs.MqttPort, _ = strconv.Atoi(config.mqttPortEntry.Text)
 			poaContext.Configs.MqttUser = config.mqttUserEntry.Text
 			poaContext.Configs.MqttPassword = config.mqttPasswordEntry.Text
-			poaContext.WriteConfig()
-
-			if oldConfigs != poaContext.Configs {
+			poaContext.Configs.RetentionEnabled = config.retentionEnabledCheck.Checked
+			poaContext.Configs.RetentionDryRun = config.retentionDryRunCheck.Checked
+			poaContext.Configs.RetentionDays, _ = strconv.Atoi(config.retentionDaysEntry.Text)
+			poaContext.Configs.AgentUpdateAddress = strings.TrimSpace(config.agentUpdateEntry.Text)
+			poaContext.Configs.RequiredAgentVersion = strings.TrimSpace(config.requiredVersionEntry.Text)
+			if err := poaContext.Configs.Validate(); err != nil {
+				poaContext.Configs = oldConfigs
+				dialog.ShowError(err, *window)
+				return
+			}
+			// only the edited fields, the values of the environment and the flags are not written
+			editedFields := context.ChangedFields(oldConfigs, poaContext.Configs)
+			write := func() {
+				if writeConfig(editedFields...) {
+					// the keys unknown to this version are not written back
+					poaContext.UnknownKeys = nil
+					config.updateUnknownKeys()
+				}
+			}
+			if poaContext.SecretKeyNeeded(editedFields...) {
+				askNewPassphrase(func(ok bool) {
+					if ok {
+						write()
+					} else {
+						dialog.ShowInformation("설정 암호", "설정 암호를 정하지 않아 설정 파일에 저장하지 않았습니다.", *window)
+					}
+				})
+			} else {
+				write()
+			}
+			poaManager.UpdateRetentionPolicy(&poaContext.Configs)
+
+			// the retention settings are applied without a restart
+			restartConfigs := oldConfigs
+			restartConfigs.RetentionEnabled = poaContext.Configs.RetentionEnabled
+			restartConfigs.RetentionDryRun = poaContext.Configs.RetentionDryRun
+			restartConfigs.RetentionDays = poaContext.Configs.RetentionDays
+			if restartConfigs != poaContext.Configs {
 				dialog.ShowInformation("접속 정보 변경", "수정 사항을 적용하려면 프로그램을 재시작 해주세요.", *window)
 			}
 		},
 		SubmitText: "저장",
 	}
 
-	config.content.Add(form)
+	config.labelSigningKey = widget.NewLabel("")
+	signingKey := container.NewHBox(widget.NewLabel("명령 서명 키"), config.labelSigningKey, layout.NewSpacer(),
+		widget.NewButton("공개키 내보내기", config.exportPublicKey),
+		widget.NewButton("키 교체", config.rotateSigningKey))
+
+	config.labelPayloadKey = widget.NewLabel("")
+	payloadKey := container.NewHBox(widget.NewLabel("공용 암호화 키"), config.labelPayloadKey, layout.NewSpacer(),
+		widget.NewButton("키 내보내기", config.exportPayloadKey),
+		widget.NewButton("키 교체", config.rotatePayloadKey))
+
+	config.labelUnknownKeys = widget.NewLabel("")
+	config.labelUnknownKeys.Wrapping = fyne.TextWrapWord
+	config.updateUnknownKeys()
+
+	config.content.Add(container.NewVBox(config.labelUnknownKeys, form, widget.NewSeparator(), signingKey, payloadKey))
 
 	return &config
 }
 
+// writeConfig writes the edited fields to the config file, or shows why the file is not written.
+func writeConfig(fields ...string) bool {
+	if err := poaContext.WriteConfig(fields...); err != nil {
+		logger.LogE(err)
+		dialog.ShowError(fmt.Errorf("설정 파일(%s)에 저장하지 않았습니다: %v", poaContext.ConfigPath, err), *window)
+		return false
+	}
+	return true
+}
+
+func (config *contentConfig) updateUnknownKeys() {
+	if err := poaContext.ConfigReadOnly(); err != nil {
+		config.labelUnknownKeys.SetText(fmt.Sprintf("설정 파일(%s)을 이 버전에서 읽을 수 없어 변경 사항은 저장되지 않습니다: %v", poaContext.ConfigPath, err))
+		config.labelUnknownKeys.Show()
+		return
+	}
+	if len(poaContext.UnknownKeys) == 0 {
+		config.labelUnknownKeys.Hide()
+		return
+	}
+
+	config.labelUnknownKeys.SetText(fmt.Sprintf("설정 파일(%s)에 이 버전에서 사용하지 않는 항목이 있습니다: %s\n저장하면 해당 항목은 삭제됩니다.",
+		poaContext.ConfigPath, strings.Join(poaContext.UnknownKeys, ", ")))
+	config.labelUnknownKeys.Show()
+}
+
+func (config *contentConfig) updateSigningKey() {
+	if keyId := poaManager.SigningKeyId(); keyId != "" {
+		config.labelSigningKey.SetText("ID: " + keyId)
+	} else {
+		config.labelSigningKey.SetText("없음")
+	}
+}
+
+func (config *contentConfig) exportPublicKey() {
+	doc, err := poaManager.ExportPublicKey()
+	if err != nil {
+		logger.LogE(err)
+		dialog.ShowError(err, *window)
+		return
+	}
+
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+
+		if _, err := writer.Write(doc); err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+		}
+	}, *window)
+	saveDialog.SetFileName(fmt.Sprintf("poa_command_%s.pub", poaManager.SigningKeyId()))
+	saveDialog.Show()
+}
+
+func (config *contentConfig) rotateSigningKey() {
+	if !allowed(auth.PermissionKeys) {
+		return
+	}
+
+	dialog.ShowConfirm("명령 서명 키 교체",
+		"새 키로 교체하면 이전 공개키를 사용하는 장치는 명령을 거부합니다.\n새 공개키를 장치에 배포한 뒤 사용해 주세요. 교체하시겠습니까?",
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			reauthenticate("명령 서명 키 교체", auth.PermissionKeys, func() {
+				if err := poaManager.RotateSigningKey(); err != nil {
+					logger.LogE(err)
+					dialog.ShowError(err, *window)
+				}
+				config.updateSigningKey()
+			})
+		}, *window)
+}
+
 func (config *contentConfig) GetContent() *fyne.Container {
 	return config.content
 }
@@ -0,0 +1,348 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"poa-manager/auth"
+	"poa-manager/manager"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	mqttInspectorMaxRecords = 1000
+	allDevicesOption        = "모든 장치"
+)
+
+type contentMqttInspector struct {
+	content           *fyne.Container
+	topicFilterEntry  *widget.Entry
+	selectDevice      *widget.Select
+	checkPause        *widget.Check
+	buttonRecord      *widget.Button
+	labelCount        *widget.Label
+	listMessages      *widget.List
+	labelPayload      *widget.Label
+	selectSendDevice  *widget.Select
+	selectCommandType *widget.Select
+	commandEntry      *widget.Entry
+
+	// used by the polling goroutine and the ui callbacks,
+	// the widgets are refreshed without the lock since they call back the list
+	records         []manager.MqttRecord
+	filteredRecords []manager.MqttRecord
+	lastTimestamp   int64
+	sendDeviceIds   []string
+	paused          bool
+	mutex           *sync.Mutex
+}
+
+// example payloads of the command types for the publish form
+var commandTemplates = map[string]manager.Command{
+	manager.CommandRestart: {Type: manager.CommandRestart, Restart: &manager.Restart{Restart: true}},
+	manager.CommandMqtt:    {Type: manager.CommandMqtt, Mqtt: &manager.Mqtt{MqttUser: "user", MqttPassword: "password"}},
+	manager.CommandUpdate:  {Type: manager.CommandUpdate, Update: &manager.Update{ForceUpdate: true}},
+	manager.CommandInfo:    {Type: manager.CommandInfo, Info: &manager.Info{Owner: "owner", OwnNumber: 1, DeviceDesc: "desc"}},
+}
+
+func newMqttInspectorContent() *contentMqttInspector {
+	inspector := contentMqttInspector{mutex: &sync.Mutex{}}
+
+	inspector.content = container.NewMax()
+
+	inspector.topicFilterEntry = widget.NewEntry()
+	inspector.topicFilterEntry.SetPlaceHolder("토픽 필터")
+	inspector.topicFilterEntry.OnChanged = func(string) {
+		inspector.applyFilter()
+	}
+	inspector.selectDevice = widget.NewSelect([]string{allDevicesOption}, func(string) {
+		inspector.applyFilter()
+	})
+	inspector.checkPause = widget.NewCheck("일시 정지", func(check bool) {
+		inspector.mutex.Lock()
+		inspector.paused = check
+		inspector.mutex.Unlock()
+	})
+	inspector.buttonRecord = widget.NewButton("녹화 시작", inspector.toggleRecording)
+	inspector.labelCount = widget.NewLabel("")
+
+	inspector.listMessages = widget.NewList(
+		func() int {
+			inspector.mutex.Lock()
+			defer inspector.mutex.Unlock()
+
+			return len(inspector.filteredRecords)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			record, ok := inspector.filteredRecord(id)
+			if !ok {
+				return
+			}
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s  %s", time.Unix(0, record.Timestamp).Format("15:04:05.000"), record.Topic))
+		})
+	inspector.listMessages.OnSelected = func(id widget.ListItemID) {
+		if record, ok := inspector.filteredRecord(id); ok {
+			inspector.labelPayload.SetText(formatMqttRecord(&record))
+		}
+	}
+	inspector.labelPayload = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+
+	split := container.NewHSplit(inspector.listMessages, container.NewScroll(inspector.labelPayload))
+	split.Offset = 0.45
+
+	commandTypes := []string{}
+	for commandType := range commandTemplates {
+		commandTypes = append(commandTypes, commandType)
+	}
+	sort.Strings(commandTypes)
+
+	inspector.selectSendDevice = widget.NewSelect([]string{}, nil)
+	inspector.selectSendDevice.PlaceHolder = "장치 선택"
+	inspector.commandEntry = widget.NewMultiLineEntry()
+	inspector.commandEntry.TextStyle = fyne.TextStyle{Monospace: true}
+	inspector.selectCommandType = widget.NewSelect(commandTypes, func(commandType string) {
+		doc, _ := json.MarshalIndent(commandTemplates[commandType], "", "    ")
+		inspector.commandEntry.SetText(string(doc))
+	})
+	inspector.selectCommandType.SetSelected(manager.CommandRestart)
+
+	publishForm := container.NewBorder(
+		container.NewHBox(widget.NewLabel("명령 전송"), inspector.selectSendDevice, inspector.selectCommandType, layout.NewSpacer(),
+			widget.NewButton("보내기", inspector.publishCommand)),
+		nil, nil, nil, inspector.commandEntry)
+
+	toolbar := container.NewBorder(nil, nil, nil,
+		container.NewHBox(inspector.selectDevice, inspector.checkPause, widget.NewButton("지우기", inspector.clear), inspector.buttonRecord, inspector.labelCount),
+		inspector.topicFilterEntry)
+
+	mainSplit := container.NewVSplit(split, publishForm)
+	mainSplit.Offset = 0.7
+
+	inspector.content.Add(container.NewBorder(toolbar, nil, nil, nil, mainSplit))
+
+	// the filter runs on selection, select after the list is created
+	inspector.selectDevice.SetSelected(allDevicesOption)
+
+	go func() {
+		for {
+			time.Sleep(time.Second)
+
+			if activeContect == inspector.content && !inspector.isPaused() {
+				inspector.updateView()
+			}
+		}
+	}()
+
+	return &inspector
+}
+
+func (inspector *contentMqttInspector) GetContent() *fyne.Container {
+	return inspector.content
+}
+
+func (inspector *contentMqttInspector) SetMainContent() {
+	if parentContainer != nil {
+		parentContainer.Objects = []fyne.CanvasObject{inspector.content}
+		activeContect = inspector.content
+	}
+}
+
+func formatMqttRecord(record *manager.MqttRecord) string {
+	text := fmt.Sprintf("시간: %s\n토픽: %s\nQoS: %d, Retained: %v\n\n",
+		time.Unix(0, record.Timestamp).Format("2006-01-02 15:04:05.000"), record.Topic, record.Qos, record.Retained)
+
+	if record.PayloadBase64 != "" {
+		return text + "(binary) " + record.PayloadBase64
+	}
+
+	indented := bytes.Buffer{}
+	if err := json.Indent(&indented, []byte(record.Payload), "", "    "); err == nil {
+		return text + indented.String()
+	}
+
+	return text + record.Payload
+}
+
+func (inspector *contentMqttInspector) isPaused() bool {
+	inspector.mutex.Lock()
+	defer inspector.mutex.Unlock()
+
+	return inspector.paused
+}
+
+func (inspector *contentMqttInspector) filteredRecord(id widget.ListItemID) (manager.MqttRecord, bool) {
+	inspector.mutex.Lock()
+	defer inspector.mutex.Unlock()
+
+	if id < 0 || id >= len(inspector.filteredRecords) {
+		return manager.MqttRecord{}, false
+	}
+	return inspector.filteredRecords[id], true
+}
+
+func (inspector *contentMqttInspector) updateView() {
+	inspector.mutex.Lock()
+	records := poaManager.GetMqttMessages(inspector.lastTimestamp)
+	if len(records) > 0 {
+		inspector.lastTimestamp = records[len(records)-1].Timestamp
+		inspector.records = append(inspector.records, records...)
+		if len(inspector.records) > mqttInspectorMaxRecords {
+			inspector.records = inspector.records[len(inspector.records)-mqttInspectorMaxRecords:]
+		}
+	}
+	inspector.mutex.Unlock()
+
+	if len(records) > 0 {
+		inspector.applyFilter()
+	}
+
+	inspector.updateDeviceOptions()
+	inspector.updateRecordButton()
+}
+
+func (inspector *contentMqttInspector) applyFilter() {
+	topicFilter := strings.TrimSpace(inspector.topicFilterEntry.Text)
+	deviceId := ""
+	if inspector.selectDevice.Selected != allDevicesOption {
+		deviceId = inspector.selectDevice.Selected
+	}
+
+	inspector.mutex.Lock()
+	filtered := []manager.MqttRecord{}
+	for _, record := range inspector.records {
+		if topicFilter != "" && !strings.Contains(record.Topic, topicFilter) {
+			continue
+		}
+		if deviceId != "" && manager.TopicDeviceId(record.Topic) != deviceId {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+
+	inspector.filteredRecords = filtered
+	total := len(inspector.records)
+	inspector.mutex.Unlock()
+
+	inspector.labelCount.SetText(fmt.Sprintf("%d / %d 건", len(filtered), total))
+	inspector.listMessages.Refresh()
+}
+
+func (inspector *contentMqttInspector) clear() {
+	inspector.mutex.Lock()
+	inspector.records = nil
+	inspector.mutex.Unlock()
+
+	inspector.listMessages.UnselectAll()
+	inspector.labelPayload.SetText("")
+	inspector.applyFilter()
+}
+
+func (inspector *contentMqttInspector) updateDeviceOptions() {
+	deviceIds := []string{}
+	sendOptions := []string{}
+	for _, device := range poaManager.GetTotalDevices() {
+		deviceIds = append(deviceIds, device.DeviceId)
+		sendOptions = append(sendOptions, fmt.Sprintf("%s (%s)", deviceTitle(device), device.DeviceId))
+	}
+
+	inspector.selectDevice.Options = append([]string{allDevicesOption}, deviceIds...)
+	inspector.selectDevice.Refresh()
+
+	selectedId := inspector.sendDeviceId()
+	inspector.mutex.Lock()
+	inspector.sendDeviceIds = deviceIds
+	inspector.mutex.Unlock()
+	inspector.selectSendDevice.Options = sendOptions
+	inspector.selectSendDevice.ClearSelected()
+	for i, deviceId := range deviceIds {
+		if deviceId == selectedId {
+			inspector.selectSendDevice.SetSelectedIndex(i)
+		}
+	}
+	inspector.selectSendDevice.Refresh()
+}
+
+// sendDeviceId returns the id of the device selected in the publish form.
+func (inspector *contentMqttInspector) sendDeviceId() string {
+	index := inspector.selectSendDevice.SelectedIndex()
+
+	inspector.mutex.Lock()
+	defer inspector.mutex.Unlock()
+
+	if index < 0 || index >= len(inspector.sendDeviceIds) {
+		return ""
+	}
+	return inspector.sendDeviceIds[index]
+}
+
+func (inspector *contentMqttInspector) publishCommand() {
+	deviceId := inspector.sendDeviceId()
+	if deviceId == "" {
+		dialog.ShowInformation("명령 전송", "명령을 보낼 장치를 선택해 주세요.", *window)
+		return
+	}
+	if !allowed(auth.PermissionCommand) {
+		return
+	}
+
+	dialog.ShowConfirm("명령 전송", fmt.Sprintf("장치 %s 에 명령을 전송하시겠습니까?", deviceId), func(ok bool) {
+		if !ok {
+			return
+		}
+
+		if err := poaManager.PublishRawCommand(deviceId, inspector.commandEntry.Text); err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+		}
+	}, *window)
+}
+
+func (inspector *contentMqttInspector) updateRecordButton() {
+	if path, records := poaManager.Recording(); path != "" {
+		inspector.buttonRecord.SetText(fmt.Sprintf("녹화 중지 (%d)", records))
+	} else {
+		inspector.buttonRecord.SetText("녹화 시작")
+	}
+}
+
+func (inspector *contentMqttInspector) toggleRecording() {
+	if path, _ := poaManager.Recording(); path != "" {
+		poaManager.StopRecording()
+		inspector.updateRecordButton()
+		return
+	}
+
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		// the recorder opens the file itself for appending
+		writer.Close()
+
+		if err := poaManager.StartRecording(writer.URI().Path()); err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+		}
+		inspector.updateRecordButton()
+	}, *window)
+	saveDialog.SetFileName(fmt.Sprintf("mqtt_%s.jsonl", time.Now().Format("20060102_150405")))
+	saveDialog.Show()
+}
@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+const passphraseAttempts = 3
+
+// AskPassphrase asks the config passphrase at startup if the secrets of the
+// config file are locked, or a new one if the secrets have no key yet, then
+// calls done. The secrets stay locked if the operator skips it.
+func AskPassphrase(done func()) {
+	if poaContext.SecretsLocked() {
+		askUnlockPassphrase(passphraseAttempts, done)
+	} else if poaContext.SecretKeyNeeded() {
+		askNewPassphrase(func(ok bool) {
+			if ok {
+				// the plaintext secrets are encrypted with the new key
+				writeConfig()
+			}
+			done()
+		})
+	} else {
+		done()
+	}
+}
+
+func askUnlockPassphrase(attempts int, done func()) {
+	text := "설정 파일의 MQTT 패스워드가 암호화되어 있습니다.\n설정 암호를 입력해 주세요."
+	if attempts < passphraseAttempts {
+		text = "암호가 올바르지 않습니다. 다시 입력해 주세요."
+	}
+
+	entryPassphrase := widget.NewPasswordEntry()
+	content := container.NewVBox(widget.NewLabel(text), entryPassphrase)
+
+	passphraseDialog := dialog.NewCustomConfirm("설정 암호", "확인", "건너뛰기", content, func(ok bool) {
+		if !ok {
+			logger.LogW("the config secrets stay locked")
+			done()
+			return
+		}
+
+		if err := poaContext.UnlockSecrets(entryPassphrase.Text); err != nil {
+			logger.LogW("wrong config passphrase")
+			if attempts > 1 {
+				askUnlockPassphrase(attempts-1, done)
+				return
+			}
+			dialog.ShowInformation("설정 암호", "암호가 올바르지 않습니다.\nMQTT 패스워드 없이 시작합니다.", *window)
+		}
+		done()
+	}, *window)
+	passphraseDialog.Show()
+	(*window).Canvas().Focus(entryPassphrase)
+}
+
+// askNewPassphrase sets the passphrase the secrets of the config file are encrypted with,
+// when the os keyring is not available.
+func askNewPassphrase(done func(ok bool)) {
+	entryPassphrase := widget.NewPasswordEntry()
+	entryConfirm := widget.NewPasswordEntry()
+	content := container.NewVBox(widget.NewLabel("OS 키링을 사용할 수 없습니다.\nMQTT 패스워드를 암호화할 설정 암호를 정해 주세요."),
+		widget.NewForm(&widget.FormItem{Text: "설정 암호", Widget: entryPassphrase}, &widget.FormItem{Text: "암호 확인", Widget: entryConfirm}))
+
+	dialog.ShowCustomConfirm("설정 암호", "확인", "취소", content, func(ok bool) {
+		if !ok {
+			done(false)
+			return
+		}
+
+		if entryPassphrase.Text != entryConfirm.Text {
+			dialog.ShowInformation("설정 암호", "암호가 일치하지 않습니다.", *window)
+			askNewPassphrase(done)
+			return
+		}
+		if err := poaContext.SetSecretPassphrase(entryPassphrase.Text); err != nil {
+			logger.LogE(err)
+			dialog.ShowError(err, *window)
+			done(false)
+			return
+		}
+		done(true)
+	}, *window)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -45,6 +46,8 @@ func (updater *Updater) Init(context *context.Context) {
 	updater.interval = context.Configs.UpdateCheckIntervalSec
 }
 
+var versionRegexp = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+$`)
+
 func versionCompare(ver1, ver2 string) VersionRO {
 	var major1, minor1, patch1 int
 	var major2, minor2, patch2 int
@@ -88,6 +91,23 @@ func versionCompare(ver1, ver2 string) VersionRO {
 	return eq
 }
 
+// IsOlderVersion reports whether ver is older than other. Versions are
+// compared as vMAJOR.MINOR.PATCH, malformed ones are never considered older.
+func IsOlderVersion(ver, other string) bool {
+	// versionCompare reads the non numeric parts as 0
+	if !versionRegexp.MatchString(ver) || !versionRegexp.MatchString(other) {
+		return false
+	}
+
+	return versionCompare(ver, other) == lt
+}
+
+// LatestVersion returns the latest release of the github repository.
+func LatestVersion(repositoryURL string) (string, error) {
+	p := &provider.Github{RepositoryURL: repositoryURL}
+	return p.GetLatestVersion()
+}
+
 func verify(u *rokUpdater.Updater) error {
 	latestVersion, err := u.GetLatestVersion()
 	if err != nil {
@@ -126,34 +146,35 @@ func (updater *Updater) update() (bool, error) {
 	}
 
 	lastestVersion, err := u.GetLatestVersion()
+	updateLogger := logger.With("repository", updater.github, "version", u.Version, "latest", lastestVersion)
 
-	logger.LogFormat(log.Debug, "check version: current Version = %s, server Version = %s\n", u.Version, lastestVersion)
+	updateLogger.LogFormat(log.Debug, "check version: current Version = %s, server Version = %s", u.Version, lastestVersion)
 
 	if err == nil {
 		if versionCompare(u.Version, lastestVersion) == lt {
-			logger.LogI("software update start")
+			updateLogger.LogI("software update start")
 			updateStatus, err := u.Update()
 			if err != nil {
-				logger.LogE(err)
+				updateLogger.LogE(err)
 			}
 			if updateStatus == rokUpdater.Updated {
 				if err := verify(u); err != nil {
-					logger.LogE(err)
-					logger.LogW("Rolling back...")
+					updateLogger.LogE(err)
+					updateLogger.LogW("Rolling back...")
 					u.Rollback()
 					return false, err
 				}
 
-				logger.LogI("software update complete.")
+				updateLogger.LogI("software update complete.")
 				return true, nil
 			} else {
-				logger.LogW("software update failed.")
+				updateLogger.LogW("software update failed.")
 			}
 		}
 
 		return false, errors.New("software update failed")
 	} else {
-		logger.LogE(err)
+		updateLogger.LogE(err)
 		return false, err
 	}
 }